@@ -0,0 +1,155 @@
+package backpressure
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Decision int
+
+const (
+	Accept Decision = iota
+	Defer
+	Reject
+)
+
+func (d Decision) String() string {
+	switch d {
+	case Defer:
+		return "defer"
+	case Reject:
+		return "reject"
+	default:
+		return "accept"
+	}
+}
+
+// Config holds the backlog thresholds. A zero limit disables that threshold.
+type Config struct {
+	SoftLimit  int64
+	HardLimit  int64
+	CacheTTL   time.Duration
+	RetryAfter time.Duration
+	DeferDelay time.Duration
+}
+
+// LoadConfig reads the thresholds from the environment.
+func LoadConfig() Config {
+	return Config{
+		SoftLimit:  envInt("UPLOAD_BACKLOG_SOFT_LIMIT", 0),
+		HardLimit:  envInt("UPLOAD_BACKLOG_HARD_LIMIT", 0),
+		CacheTTL:   envDuration("UPLOAD_BACKLOG_CACHE_TTL", 5*time.Second),
+		RetryAfter: envDuration("UPLOAD_RETRY_AFTER", 30*time.Second),
+		DeferDelay: envDuration("UPLOAD_DEFER_DELAY", 5*time.Minute),
+	}
+}
+
+// BacklogFunc returns the current number of pending processing jobs.
+type BacklogFunc func(ctx context.Context) (int64, error)
+
+// Gate decides whether new uploads are accepted, deferred or rejected based
+// on the processing backlog. The backlog is read at most once per CacheTTL,
+// so the per-request cost is a mutex and a comparison, and a slow read does
+// not hold up the requests that arrive meanwhile.
+type Gate struct {
+	Config  Config
+	Backlog BacklogFunc
+
+	mu        sync.Mutex
+	backlog   int64
+	checkedAt time.Time
+	// Closed when the backlog read in flight finishes; nil when none is
+	refreshing chan struct{}
+	now        func() time.Time
+}
+
+func NewGate(cfg Config, backlog BacklogFunc) *Gate {
+	return &Gate{Config: cfg, Backlog: backlog, now: time.Now}
+}
+
+// Check returns the decision for an upload and the backlog it was based on.
+// Low-priority uploads are deferred past the soft limit; every upload is
+// rejected past the hard limit.
+func (g *Gate) Check(ctx context.Context, lowPriority bool) (Decision, int64) {
+	if g == nil || (g.Config.SoftLimit <= 0 && g.Config.HardLimit <= 0) {
+		return Accept, 0
+	}
+
+	backlog := g.currentBacklog(ctx)
+
+	if g.Config.HardLimit > 0 && backlog >= g.Config.HardLimit {
+		return Reject, backlog
+	}
+	if lowPriority && g.Config.SoftLimit > 0 && backlog >= g.Config.SoftLimit {
+		return Defer, backlog
+	}
+
+	return Accept, backlog
+}
+
+// currentBacklog returns the cached backlog, refreshing it once the TTL is
+// over. The lock is not held while the queue is read: one request refreshes
+// and the others keep using the last known value, or wait for the first
+// read when there is none yet.
+func (g *Gate) currentBacklog(ctx context.Context) int64 {
+	g.mu.Lock()
+	now := g.now()
+	if !g.checkedAt.IsZero() && now.Sub(g.checkedAt) < g.Config.CacheTTL {
+		defer g.mu.Unlock()
+		return g.backlog
+	}
+	if refreshing := g.refreshing; refreshing != nil {
+		if !g.checkedAt.IsZero() {
+			defer g.mu.Unlock()
+			return g.backlog
+		}
+		g.mu.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.backlog
+	}
+	refreshing := make(chan struct{})
+	g.refreshing = refreshing
+	g.mu.Unlock()
+
+	backlog, err := g.Backlog(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		// Keep the last known value rather than failing uploads because the
+		// queue could not be inspected.
+		log.Printf("Error reading processing backlog: %v", err)
+	} else {
+		g.backlog = backlog
+	}
+	g.checkedAt = now
+	g.refreshing = nil
+	close(refreshing)
+
+	return g.backlog
+}
+
+func envInt(key string, def int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
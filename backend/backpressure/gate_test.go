@@ -0,0 +1,134 @@
+package backpressure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGate_Thresholds(t *testing.T) {
+	backlog := int64(0)
+	gate := NewGate(Config{SoftLimit: 10, HardLimit: 20}, func(ctx context.Context) (int64, error) {
+		return backlog, nil
+	})
+
+	cases := []struct {
+		backlog     int64
+		lowPriority bool
+		want        Decision
+	}{
+		{5, false, Accept},
+		{5, true, Accept},
+		{10, false, Accept},
+		{10, true, Defer},
+		{20, false, Reject},
+		{20, true, Reject},
+	}
+
+	for _, c := range cases {
+		backlog = c.backlog
+		if got, _ := gate.Check(context.Background(), c.lowPriority); got != c.want {
+			t.Errorf("backlog=%d lowPriority=%v: expected %s, got %s", c.backlog, c.lowPriority, c.want, got)
+		}
+	}
+}
+
+func TestGate_CachesBacklog(t *testing.T) {
+	calls := 0
+	now := time.Now()
+	gate := NewGate(Config{HardLimit: 1, CacheTTL: time.Second}, func(ctx context.Context) (int64, error) {
+		calls++
+		return 0, nil
+	})
+	gate.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		gate.Check(context.Background(), false)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 backlog read within the TTL, got %d", calls)
+	}
+
+	now = now.Add(2 * time.Second)
+	gate.Check(context.Background(), false)
+	if calls != 2 {
+		t.Fatalf("expected backlog to be refreshed after the TTL, got %d reads", calls)
+	}
+}
+
+func TestGate_KeepsLastBacklogOnError(t *testing.T) {
+	fail := false
+	now := time.Now()
+	gate := NewGate(Config{HardLimit: 5}, func(ctx context.Context) (int64, error) {
+		if fail {
+			return 0, errors.New("queue unavailable")
+		}
+		return 8, nil
+	})
+	gate.now = func() time.Time { return now }
+
+	gate.Check(context.Background(), false)
+	fail = true
+	now = now.Add(time.Minute)
+
+	if got, backlog := gate.Check(context.Background(), false); got != Reject || backlog != 8 {
+		t.Fatalf("expected reject with last known backlog 8, got %s with %d", got, backlog)
+	}
+}
+
+func TestGate_DisabledWhenNil(t *testing.T) {
+	var gate *Gate
+	if got, _ := gate.Check(context.Background(), true); got != Accept {
+		t.Fatalf("expected nil gate to accept, got %s", got)
+	}
+}
+
+func TestGate_SlowReadDoesNotBlock(t *testing.T) {
+	now := time.Now()
+	release := make(chan struct{})
+	reads := 0
+	gate := NewGate(Config{HardLimit: 5, CacheTTL: time.Second}, func(ctx context.Context) (int64, error) {
+		reads++
+		if reads > 1 {
+			<-release
+		}
+		return 8, nil
+	})
+	gate.now = func() time.Time { return now }
+	gate.Check(context.Background(), false)
+
+	// The refresh after the TTL hangs on the queue
+	now = now.Add(2 * time.Second)
+	done := make(chan struct{})
+	go func() {
+		gate.Check(context.Background(), false)
+		close(done)
+	}()
+	for {
+		gate.mu.Lock()
+		refreshing := gate.refreshing != nil
+		gate.mu.Unlock()
+		if refreshing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	result := make(chan Decision, 1)
+	go func() {
+		got, _ := gate.Check(context.Background(), false)
+		result <- got
+	}()
+	select {
+	case got := <-result:
+		if got != Reject {
+			t.Errorf("expected the last known backlog to reject, got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the check not to wait for the slow read")
+	}
+
+	close(release)
+	<-done
+}
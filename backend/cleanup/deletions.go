@@ -0,0 +1,176 @@
+package cleanup
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/storage"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeletionRunner removes the stored objects queued in storage_deletions,
+// retrying with exponential backoff. Deletions that keep failing are left
+// as "failed" rows, which is the audit trail once the video row is gone.
+type DeletionRunner struct {
+	DB          *gorm.DB
+	Store       *storage.ObjectStore
+	MaxAttempts int
+	BatchSize   int
+	// How long an unreferenced original is kept after it was last stored,
+	// so the upload that stored it has time to create its video
+	StoredGrace time.Duration
+}
+
+func NewDeletionRunner(db *gorm.DB, store *storage.ObjectStore) *DeletionRunner {
+	return &DeletionRunner{DB: db, Store: store, MaxAttempts: 8, BatchSize: 50, StoredGrace: time.Hour}
+}
+
+// Run processes due deletions every interval until ctx is cancelled.
+func (d *DeletionRunner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.RunOnce(ctx); err != nil {
+			log.Printf("Error processing storage deletions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce processes one batch of due deletions and returns how many were
+// attempted. Rows are locked with SKIP LOCKED so several workers can run it.
+func (d *DeletionRunner) RunOnce(ctx context.Context) (int, error) {
+	processed := 0
+
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deletions := []models.StorageDeletion{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+			Order("next_attempt_at").
+			Limit(d.BatchSize).
+			Find(&deletions).Error; err != nil {
+			return err
+		}
+
+		for i := range deletions {
+			d.attempt(ctx, &deletions[i])
+			if err := tx.Save(&deletions[i]).Error; err != nil {
+				return err
+			}
+			processed++
+		}
+
+		return nil
+	})
+
+	return processed, err
+}
+
+func (d *DeletionRunner) attempt(ctx context.Context, deletion *models.StorageDeletion) {
+	retryAt, err := d.delete(ctx, deletion)
+	if err == nil && retryAt != nil {
+		// Not a failed attempt: the original was just stored again
+		deletion.NextAttemptAt = *retryAt
+		return
+	}
+
+	deletion.Attempts++
+	if err == nil {
+		now := time.Now()
+		deletion.Status = "done"
+		deletion.LastError = nil
+		deletion.CompletedAt = &now
+		return
+	}
+
+	message := err.Error()
+	deletion.LastError = &message
+
+	if deletion.Attempts >= d.MaxAttempts {
+		deletion.Status = "failed"
+		log.Printf("Giving up deleting %s of video %d after %d attempts: %v",
+			deletion.ObjectKey, deletion.VideoID, deletion.Attempts, err)
+		return
+	}
+
+	backoff := time.Duration(1<<deletion.Attempts) * 30 * time.Second
+	deletion.NextAttemptAt = time.Now().Add(backoff)
+}
+
+// delete removes the objects of a deletion. Originals still referenced are
+// kept, and the ones stored too recently to tell are postponed until the
+// returned time.
+func (d *DeletionRunner) delete(ctx context.Context, deletion *models.StorageDeletion) (*time.Time, error) {
+	if !deletion.IsPrefix {
+		return d.deleteOriginal(ctx, deletion.ObjectKey)
+	}
+
+	objects, err := d.Store.List(ctx, deletion.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, *object.Key)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	return nil, d.Store.Delete(ctx, keys...)
+}
+
+// deleteOriginal deletes an original unless a video references it. Originals
+// are content-addressed, so another upload may store the same key again at
+// any time: the key is locked as storeOriginal does while copying, and a
+// copy younger than StoredGrace may still be waiting for its video.
+func (d *DeletionRunner) deleteOriginal(ctx context.Context, key string) (*time.Time, error) {
+	var retryAt *time.Time
+
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := models.LockObject(tx, key); err != nil {
+			return err
+		}
+
+		var references int64
+		if err := tx.Model(&models.Video{}).
+			Where("original_key = ?", key).
+			Count(&references).Error; err != nil {
+			return err
+		}
+		if references > 0 {
+			return nil
+		}
+
+		head, err := d.Store.Head(ctx, key)
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if head.LastModified != nil {
+			if keepUntil := head.LastModified.Add(d.StoredGrace); time.Now().Before(keepUntil) {
+				retryAt = &keepUntil
+				return nil
+			}
+		}
+
+		return d.Store.Delete(ctx, key)
+	})
+
+	return retryAt, err
+}
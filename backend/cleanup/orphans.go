@@ -0,0 +1,222 @@
+package cleanup
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/storage"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gorm.io/gorm"
+)
+
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// References are the keys the database expects to exist in storage.
+type References struct {
+	// Exact keys owned by a video, mapped to the video id
+	VideoKeys map[string]uint
+	// Key prefixes owned by a video (processed output and derived objects)
+	VideoPrefixes map[string]uint
+	// Keys of uploads still in progress and of deletions still queued; these
+	// are neither orphans nor expected to exist
+	InFlight map[string]bool
+}
+
+type MissingObject struct {
+	VideoID uint
+	Key     string
+}
+
+type Report struct {
+	Scanned        int
+	Referenced     int
+	InFlight       int
+	Orphans        []StoredObject
+	OrphanBytes    int64
+	Expired        []StoredObject
+	Deleted        int
+	Missing        []MissingObject
+	DryRun         bool
+	GracePeriod    time.Duration
+	DeletionErrors []string
+}
+
+type ReconcileOptions struct {
+	Prefixes    []string
+	GracePeriod time.Duration
+	DryRun      bool
+}
+
+// Reconcile lists the storage prefixes, compares them with the videos table
+// and deletes the orphans older than the grace period unless DryRun is set.
+func Reconcile(ctx context.Context, db *gorm.DB, store *storage.ObjectStore, opts ReconcileOptions) (*Report, error) {
+	refs, err := LoadReferences(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []StoredObject{}
+	for _, prefix := range opts.Prefixes {
+		listed, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, toStoredObjects(listed)...)
+	}
+
+	report := Classify(objects, refs, opts.Prefixes, time.Now(), opts.GracePeriod)
+	report.DryRun = opts.DryRun
+
+	if opts.DryRun || len(report.Expired) == 0 {
+		return report, nil
+	}
+
+	keys := make([]string, 0, len(report.Expired))
+	for _, object := range report.Expired {
+		keys = append(keys, object.Key)
+	}
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+		if err := store.Delete(ctx, keys[start:end]...); err != nil {
+			report.DeletionErrors = append(report.DeletionErrors, err.Error())
+			continue
+		}
+		report.Deleted += end - start
+	}
+
+	return report, nil
+}
+
+func LoadReferences(ctx context.Context, db *gorm.DB) (*References, error) {
+	refs := &References{
+		VideoKeys:     map[string]uint{},
+		VideoPrefixes: map[string]uint{},
+		InFlight:      map[string]bool{},
+	}
+
+	videos := []models.Video{}
+	if err := db.WithContext(ctx).
+		Select("id", "original_key", "processed_key").
+		Find(&videos).Error; err != nil {
+		return nil, fmt.Errorf("error loading videos: %w", err)
+	}
+	for _, video := range videos {
+		if video.OriginalKey != nil && *video.OriginalKey != "" {
+			refs.VideoKeys[*video.OriginalKey] = video.ID
+		}
+		if video.ProcessedKey != nil && *video.ProcessedKey != "" {
+			refs.VideoKeys[*video.ProcessedKey] = video.ID
+		}
+		refs.VideoPrefixes[video.DerivedPrefix()] = video.ID
+	}
+
+	uploadKeys := []string{}
+	if err := db.WithContext(ctx).
+		Model(&models.Upload{}).
+		Where("status IN ?", []string{"pending", "completing"}).
+		Pluck("object_key", &uploadKeys).Error; err != nil {
+		return nil, fmt.Errorf("error loading uploads: %w", err)
+	}
+	for _, key := range uploadKeys {
+		refs.InFlight[key] = true
+	}
+
+	deletionKeys := []string{}
+	if err := db.WithContext(ctx).
+		Model(&models.StorageDeletion{}).
+		Where("status = ? AND is_prefix = ?", "pending", false).
+		Pluck("object_key", &deletionKeys).Error; err != nil {
+		return nil, fmt.Errorf("error loading storage deletions: %w", err)
+	}
+	for _, key := range deletionKeys {
+		refs.InFlight[key] = true
+	}
+
+	return refs, nil
+}
+
+// Classify splits the listed objects into referenced, in-flight and orphan
+// objects, and finds the referenced keys under the scanned prefixes that are
+// missing from storage.
+func Classify(objects []StoredObject, refs *References, prefixes []string, now time.Time, grace time.Duration) *Report {
+	report := &Report{Scanned: len(objects), GracePeriod: grace}
+	found := map[string]bool{}
+
+	for _, object := range objects {
+		found[object.Key] = true
+
+		switch {
+		case isReferenced(object.Key, refs):
+			report.Referenced++
+		case refs.InFlight[object.Key]:
+			report.InFlight++
+		default:
+			report.Orphans = append(report.Orphans, object)
+			report.OrphanBytes += object.Size
+			if now.Sub(object.LastModified) >= grace {
+				report.Expired = append(report.Expired, object)
+			}
+		}
+	}
+
+	for key, videoID := range refs.VideoKeys {
+		if found[key] || !hasAnyPrefix(key, prefixes) {
+			continue
+		}
+		report.Missing = append(report.Missing, MissingObject{VideoID: videoID, Key: key})
+	}
+	sort.Slice(report.Missing, func(i, j int) bool {
+		return report.Missing[i].Key < report.Missing[j].Key
+	})
+
+	return report
+}
+
+func isReferenced(key string, refs *References) bool {
+	if _, ok := refs.VideoKeys[key]; ok {
+		return true
+	}
+
+	// processed/<id>_... belongs to video <id>
+	if strings.HasPrefix(key, "processed/") {
+		if end := strings.Index(key, "_"); end > 0 {
+			if _, ok := refs.VideoPrefixes[key[:end+1]]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func toStoredObjects(listed []types.Object) []StoredObject {
+	objects := make([]StoredObject, 0, len(listed))
+	for _, object := range listed {
+		stored := StoredObject{Key: *object.Key}
+		if object.Size != nil {
+			stored.Size = *object.Size
+		}
+		if object.LastModified != nil {
+			stored.LastModified = *object.LastModified
+		}
+		objects = append(objects, stored)
+	}
+	return objects
+}
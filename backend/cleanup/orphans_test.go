@@ -0,0 +1,47 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-100 * time.Hour)
+	recent := now.Add(-time.Hour)
+
+	refs := &References{
+		VideoKeys: map[string]uint{
+			"uploads/1_a.mp4":             1,
+			"processed/1_processed.mp4":   1,
+			"uploads/2_missing.mp4":       2,
+			"elsewhere/3_not_scanned.mp4": 3,
+		},
+		VideoPrefixes: map[string]uint{"processed/1_": 1},
+		InFlight:      map[string]bool{"uploads/9_pending.mp4": true},
+	}
+
+	objects := []StoredObject{
+		{Key: "uploads/1_a.mp4", LastModified: old},
+		{Key: "processed/1_processed.mp4", LastModified: old},
+		{Key: "processed/1_thumb.jpg", LastModified: old},
+		{Key: "uploads/9_pending.mp4", LastModified: old},
+		{Key: "uploads/7_orphan.mp4", Size: 10, LastModified: old},
+		{Key: "processed/12_processed.mp4", Size: 5, LastModified: recent},
+	}
+
+	report := Classify(objects, refs, []string{"uploads/", "processed/"}, now, 72*time.Hour)
+
+	if report.Scanned != 6 || report.Referenced != 3 || report.InFlight != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if len(report.Orphans) != 2 || report.OrphanBytes != 15 {
+		t.Fatalf("expected 2 orphans of 15 bytes, got %d of %d", len(report.Orphans), report.OrphanBytes)
+	}
+	if len(report.Expired) != 1 || report.Expired[0].Key != "uploads/7_orphan.mp4" {
+		t.Fatalf("expected only the old orphan to be past the grace period, got %+v", report.Expired)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Key != "uploads/2_missing.mp4" || report.Missing[0].VideoID != 2 {
+		t.Fatalf("expected uploads/2_missing.mp4 to be missing, got %+v", report.Missing)
+	}
+}
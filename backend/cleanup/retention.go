@@ -0,0 +1,322 @@
+package cleanup
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/storage"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Rule names recorded in retention_actions
+const (
+	RuleArchiveOriginals = "archive_processed_originals"
+	RuleDeleteRejected   = "delete_rejected_originals"
+	RulePurgeContests    = "purge_closed_contests"
+)
+
+// An original that fails to archive is retried after archiveBackoff, and left
+// alone after maxArchiveFailures so it does not keep taking a batch slot.
+const (
+	maxArchiveFailures = 5
+	archiveRetryBase   = time.Hour
+	archiveRetryMax    = 24 * time.Hour
+)
+
+// RetentionPolicy configures the retention rules. A rule whose age is not
+// positive is disabled.
+type RetentionPolicy struct {
+	// Move originals to ArchiveClass this long after the video was processed
+	ArchiveAfter time.Duration
+	ArchiveClass types.StorageClass
+
+	// Delete the originals of rejected videos this long after upload
+	DeleteRejectedAfter time.Duration
+
+	// Purge the videos of contests that closed more than this many months ago
+	PurgeContestsAfterMonths int
+}
+
+// LoadRetentionPolicy reads the rules from the environment. Ages are given
+// in days, except for contests, which are given in months.
+func LoadRetentionPolicy() RetentionPolicy {
+	class := types.StorageClass(os.Getenv("RETENTION_ARCHIVE_STORAGE_CLASS"))
+	if class == "" {
+		// Instant retrieval keeps the original playable
+		class = types.StorageClassGlacierIr
+	}
+
+	return RetentionPolicy{
+		ArchiveAfter:             envDays("RETENTION_ARCHIVE_AFTER_DAYS", 30),
+		ArchiveClass:             class,
+		DeleteRejectedAfter:      envDays("RETENTION_DELETE_REJECTED_AFTER_DAYS", 7),
+		PurgeContestsAfterMonths: envInt("RETENTION_PURGE_CONTESTS_AFTER_MONTHS", 0),
+	}
+}
+
+// RetentionRunner applies the retention policy and records every action in
+// retention_actions.
+type RetentionRunner struct {
+	DB        *gorm.DB
+	Store     *storage.ObjectStore
+	Policy    RetentionPolicy
+	BatchSize int
+}
+
+func NewRetentionRunner(db *gorm.DB, store *storage.ObjectStore, policy RetentionPolicy) *RetentionRunner {
+	return &RetentionRunner{DB: db, Store: store, Policy: policy, BatchSize: 50}
+}
+
+// Run applies the policy every interval until ctx is cancelled.
+func (r *RetentionRunner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if applied, err := r.RunOnce(ctx); err != nil {
+			log.Printf("Error applying retention policy: %v", err)
+		} else if applied > 0 {
+			log.Printf("Retention policy applied to %d videos", applied)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce applies each enabled rule to one batch of videos and returns how
+// many videos were handled. Videos are locked with SKIP LOCKED so several
+// workers can run it.
+func (r *RetentionRunner) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	total := 0
+
+	rules := []struct {
+		enabled bool
+		apply   func(context.Context, time.Time) (int, error)
+	}{
+		{r.Policy.ArchiveAfter > 0, r.archiveOriginals},
+		{r.Policy.DeleteRejectedAfter > 0, r.deleteRejectedOriginals},
+		{r.Policy.PurgeContestsAfterMonths > 0, r.purgeClosedContests},
+	}
+
+	for _, rule := range rules {
+		if !rule.enabled {
+			continue
+		}
+		applied, err := rule.apply(ctx, now)
+		total += applied
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// archiveCandidates selects the originals due for archiving, oldest first.
+// Originals that failed before wait for their retry time.
+func (r *RetentionRunner) archiveCandidates(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND processed_at < ?", "processed", now.Add(-r.Policy.ArchiveAfter)).
+		Where("original_key IS NOT NULL AND original_archived_at IS NULL").
+		Where("archive_failures < ? AND (archive_retry_at IS NULL OR archive_retry_at <= ?)", maxArchiveFailures, now).
+		Order("processed_at").
+		Limit(r.BatchSize)
+}
+
+// archiveBackoff is how long an original waits after its nth failure.
+func archiveBackoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	if failures > 5 {
+		return archiveRetryMax
+	}
+	return min(archiveRetryBase<<(failures-1), archiveRetryMax)
+}
+
+func (r *RetentionRunner) archiveOriginals(ctx context.Context, now time.Time) (int, error) {
+	applied := 0
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		videos := []models.Video{}
+		if err := r.archiveCandidates(tx, now).Find(&videos).Error; err != nil {
+			return err
+		}
+
+		for _, video := range videos {
+			action := newAction(video, RuleArchiveOriginals, "archive:"+string(r.Policy.ArchiveClass))
+
+			if err := r.Store.SetStorageClass(ctx, *video.OriginalKey, r.Policy.ArchiveClass); err != nil {
+				failures := video.ArchiveFailures + 1
+				message := err.Error()
+				if failures >= maxArchiveFailures {
+					message = fmt.Sprintf("giving up after %d attempts: %s", failures, message)
+				}
+				action.Status = "failed"
+				action.Error = &message
+
+				if err := tx.Model(&video).Updates(map[string]interface{}{
+					"archive_failures": failures,
+					"archive_retry_at": now.Add(archiveBackoff(failures)),
+				}).Error; err != nil {
+					return err
+				}
+			} else if err := tx.Model(&video).Update("original_archived_at", now).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Create(&action).Error; err != nil {
+				return err
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// rejectedCandidates selects the rejected videos whose original is due for
+// deletion, oldest first.
+func (r *RetentionRunner) rejectedCandidates(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND uploaded_at < ?", "rejected", now.Add(-r.Policy.DeleteRejectedAfter)).
+		Where("original_key IS NOT NULL").
+		Order("uploaded_at").
+		Limit(r.BatchSize)
+}
+
+// deleteRejectedOriginals detaches the original from rejected videos and
+// queues its deletion. The deletion runner keeps objects other videos still
+// reference, since originals are content-addressed.
+func (r *RetentionRunner) deleteRejectedOriginals(ctx context.Context, now time.Time) (int, error) {
+	applied := 0
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		videos := []models.Video{}
+		if err := r.rejectedCandidates(tx, now).Find(&videos).Error; err != nil {
+			return err
+		}
+
+		for _, video := range videos {
+			if err := tx.Model(&video).Updates(map[string]interface{}{
+				"original_key":        nil,
+				"original_deleted_at": now,
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Create(&models.StorageDeletion{
+				VideoID:       video.ID,
+				ObjectKey:     *video.OriginalKey,
+				Status:        "pending",
+				NextAttemptAt: now,
+			}).Error; err != nil {
+				return err
+			}
+
+			action := newAction(video, RuleDeleteRejected, "delete_original")
+			if err := tx.Create(&action).Error; err != nil {
+				return err
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// purgeCutoff is when a contest must have ended for its videos to be purged.
+func (r *RetentionRunner) purgeCutoff(now time.Time) time.Time {
+	return now.AddDate(0, -r.Policy.PurgeContestsAfterMonths, 0)
+}
+
+// contestCandidates selects the videos of the contests that ended before
+// cutoff.
+func (r *RetentionRunner) contestCandidates(tx *gorm.DB, cutoff time.Time) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("contest_id IN (?)", tx.Model(&models.Contest{}).Select("id").Where("ends_at < ?", cutoff)).
+		Order("id").
+		Limit(r.BatchSize)
+}
+
+// purgeClosedContests deletes the videos of long closed contests with their
+// votes and views, and queues the deletion of everything they stored.
+func (r *RetentionRunner) purgeClosedContests(ctx context.Context, now time.Time) (int, error) {
+	applied := 0
+	cutoff := r.purgeCutoff(now)
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		videos := []models.Video{}
+		if err := r.contestCandidates(tx, cutoff).Find(&videos).Error; err != nil {
+			return err
+		}
+
+		for _, video := range videos {
+			if err := tx.Where("video_id = ?", video.ID).Delete(&models.Vote{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("video_id = ?", video.ID).Delete(&models.VoteEvent{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("video_id = ?", video.ID).Delete(&models.VideoView{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&video).Error; err != nil {
+				return err
+			}
+			if deletions := models.VideoDeletions(video); len(deletions) > 0 {
+				if err := tx.Create(&deletions).Error; err != nil {
+					return err
+				}
+			}
+
+			action := newAction(video, RulePurgeContests, fmt.Sprintf("purge:contest_%d", *video.ContestID))
+			if err := tx.Create(&action).Error; err != nil {
+				return err
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+func newAction(video models.Video, rule, action string) models.RetentionAction {
+	return models.RetentionAction{
+		VideoID:   video.ID,
+		Rule:      rule,
+		Action:    action,
+		ObjectKey: video.OriginalKey,
+		Status:    "done",
+	}
+}
+
+func envDays(key string, def int) time.Duration {
+	return time.Duration(envInt(key, def)) * 24 * time.Hour
+}
+
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,150 @@
+package cleanup
+
+import (
+	"back-end-todolist/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds the SQL of a query without a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("error opening dry run database: %v", err)
+	}
+	return db
+}
+
+// selection returns the SQL and arguments of a candidate query.
+func selection(query *gorm.DB) (string, []interface{}) {
+	videos := []models.Video{}
+	stmt := query.Find(&videos).Statement
+	return stmt.SQL.String(), stmt.Vars
+}
+
+func TestLoadRetentionPolicy_Defaults(t *testing.T) {
+	t.Setenv("RETENTION_ARCHIVE_AFTER_DAYS", "")
+	t.Setenv("RETENTION_ARCHIVE_STORAGE_CLASS", "")
+	t.Setenv("RETENTION_DELETE_REJECTED_AFTER_DAYS", "")
+	t.Setenv("RETENTION_PURGE_CONTESTS_AFTER_MONTHS", "")
+
+	policy := LoadRetentionPolicy()
+
+	if policy.ArchiveAfter != 30*24*time.Hour {
+		t.Errorf("expected archive after 30 days, got %s", policy.ArchiveAfter)
+	}
+	if policy.ArchiveClass != types.StorageClassGlacierIr {
+		t.Errorf("expected %s, got %s", types.StorageClassGlacierIr, policy.ArchiveClass)
+	}
+	if policy.DeleteRejectedAfter != 7*24*time.Hour {
+		t.Errorf("expected rejected originals deleted after 7 days, got %s", policy.DeleteRejectedAfter)
+	}
+	if policy.PurgeContestsAfterMonths != 0 {
+		t.Errorf("expected contest purge disabled, got %d months", policy.PurgeContestsAfterMonths)
+	}
+}
+
+func TestLoadRetentionPolicy_Overrides(t *testing.T) {
+	t.Setenv("RETENTION_ARCHIVE_AFTER_DAYS", "0")
+	t.Setenv("RETENTION_ARCHIVE_STORAGE_CLASS", "DEEP_ARCHIVE")
+	t.Setenv("RETENTION_DELETE_REJECTED_AFTER_DAYS", "1")
+	t.Setenv("RETENTION_PURGE_CONTESTS_AFTER_MONTHS", "6")
+
+	policy := LoadRetentionPolicy()
+
+	if policy.ArchiveAfter != 0 {
+		t.Errorf("expected archiving disabled, got %s", policy.ArchiveAfter)
+	}
+	if policy.ArchiveClass != types.StorageClassDeepArchive {
+		t.Errorf("expected %s, got %s", types.StorageClassDeepArchive, policy.ArchiveClass)
+	}
+	if policy.DeleteRejectedAfter != 24*time.Hour {
+		t.Errorf("expected 1 day, got %s", policy.DeleteRejectedAfter)
+	}
+	if policy.PurgeContestsAfterMonths != 6 {
+		t.Errorf("expected 6 months, got %d", policy.PurgeContestsAfterMonths)
+	}
+}
+
+func TestArchiveBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{4, 8 * time.Hour},
+		{5, 16 * time.Hour},
+		{6, 24 * time.Hour},
+		{60, 24 * time.Hour},
+	}
+
+	for _, c := range cases {
+		if got := archiveBackoff(c.failures); got != c.want {
+			t.Errorf("archiveBackoff(%d) = %s, want %s", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestRetentionRunner_ArchiveCandidates(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	runner := &RetentionRunner{Policy: RetentionPolicy{ArchiveAfter: 30 * 24 * time.Hour}, BatchSize: 50}
+
+	sql, vars := selection(runner.archiveCandidates(dryRunDB(t), now))
+
+	for _, fragment := range []string{
+		"status = $1 AND processed_at < $2",
+		"original_archived_at IS NULL",
+		"archive_failures < $3 AND (archive_retry_at IS NULL OR archive_retry_at <= $4)",
+		"ORDER BY processed_at",
+		"FOR UPDATE SKIP LOCKED",
+	} {
+		if !strings.Contains(sql, fragment) {
+			t.Errorf("expected %q in %s", fragment, sql)
+		}
+	}
+	if vars[0] != "processed" || vars[1] != now.AddDate(0, 0, -30) || vars[2] != maxArchiveFailures || vars[3] != now {
+		t.Errorf("unexpected arguments %v", vars)
+	}
+}
+
+func TestRetentionRunner_RejectedCandidates(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	runner := &RetentionRunner{Policy: RetentionPolicy{DeleteRejectedAfter: 7 * 24 * time.Hour}, BatchSize: 50}
+
+	sql, vars := selection(runner.rejectedCandidates(dryRunDB(t), now))
+
+	if !strings.Contains(sql, "status = $1 AND uploaded_at < $2") || !strings.Contains(sql, "original_key IS NOT NULL") {
+		t.Errorf("unexpected selection %s", sql)
+	}
+	if vars[0] != "rejected" || vars[1] != now.AddDate(0, 0, -7) {
+		t.Errorf("unexpected arguments %v", vars)
+	}
+}
+
+func TestRetentionRunner_ContestCandidates(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	runner := &RetentionRunner{Policy: RetentionPolicy{PurgeContestsAfterMonths: 6}, BatchSize: 50}
+
+	cutoff := runner.purgeCutoff(now)
+	if want := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC); !cutoff.Equal(want) {
+		t.Errorf("expected cutoff %s, got %s", want, cutoff)
+	}
+
+	sql, vars := selection(runner.contestCandidates(dryRunDB(t), cutoff))
+
+	if !strings.Contains(sql, `contest_id IN (SELECT "id" FROM "contests" WHERE ends_at < $1)`) {
+		t.Errorf("unexpected selection %s", sql)
+	}
+	if vars[0] != cutoff {
+		t.Errorf("unexpected arguments %v", vars)
+	}
+}
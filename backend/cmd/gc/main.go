@@ -0,0 +1,71 @@
+package main
+
+import (
+	"back-end-todolist/bootstrap"
+	"back-end-todolist/cleanup"
+	"back-end-todolist/storage"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reconciles the objects stored under the video prefixes against the videos
+// table, reporting orphans and missing objects, and deletes the orphans older
+// than the grace period when run with -dry-run=false.
+func main() {
+	dryRun := flag.Bool("dry-run", true, "only report, do not delete anything")
+	grace := flag.Duration("grace", 72*time.Hour, "minimum age of an orphan before it is deleted")
+	prefixes := flag.String("prefixes", "uploads/,processed/", "comma separated storage prefixes to scan")
+	verbose := flag.Bool("v", false, "list every orphan and missing object")
+	flag.Parse()
+
+	db := bootstrap.InitDB()
+
+	awsSettings := storage.LoadAWSSettings()
+	cfg, err := storage.LoadAWSConfig(context.TODO(), awsSettings)
+	if err != nil {
+		log.Fatalf("Error loading AWS config: %v", err)
+	}
+	store := storage.NewObjectStore(cfg, awsSettings)
+
+	report, err := cleanup.Reconcile(context.TODO(), db, store, cleanup.ReconcileOptions{
+		Prefixes:    strings.Split(*prefixes, ","),
+		GracePeriod: *grace,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		log.Fatalf("Error reconciling storage: %v", err)
+	}
+
+	if *verbose {
+		for _, object := range report.Orphans {
+			fmt.Printf("orphan   %s (%d bytes, %s)\n", object.Key, object.Size, object.LastModified.Format(time.RFC3339))
+		}
+		for _, missing := range report.Missing {
+			fmt.Printf("missing  %s (video %d)\n", missing.Key, missing.VideoID)
+		}
+	}
+
+	fmt.Printf("Scanned objects:      %d\n", report.Scanned)
+	fmt.Printf("Referenced objects:   %d\n", report.Referenced)
+	fmt.Printf("In-flight objects:    %d\n", report.InFlight)
+	fmt.Printf("Orphan objects:       %d (%d bytes)\n", len(report.Orphans), report.OrphanBytes)
+	fmt.Printf("Older than %-10s %d\n", report.GracePeriod.String()+":", len(report.Expired))
+	fmt.Printf("Missing objects:      %d\n", len(report.Missing))
+	if report.DryRun {
+		fmt.Println("Dry run: nothing was deleted (use -dry-run=false to delete)")
+	} else {
+		fmt.Printf("Deleted orphans:      %d\n", report.Deleted)
+	}
+
+	for _, e := range report.DeletionErrors {
+		log.Printf("Deletion error: %s", e)
+	}
+	if len(report.DeletionErrors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"back-end-todolist/bootstrap"
+	"back-end-todolist/cleanup"
+	"back-end-todolist/metrics"
 	"back-end-todolist/models"
+	"back-end-todolist/storage"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -14,8 +16,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"gorm.io/gorm"
 )
@@ -23,15 +23,37 @@ import (
 func main() {
 	db := bootstrap.InitDB()
 
-	region := os.Getenv("AWS_REGION")
 	queueURL := os.Getenv("SQS_QUEUE_URL")
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	// The clients are built once and shared by every job
+	awsSettings := storage.LoadAWSSettings()
+	cfg, err := storage.LoadAWSConfig(context.TODO(), awsSettings)
 	if err != nil {
 		log.Fatalf("Error loading AWS config: %v", err)
 	}
+	awsLatency := metrics.NewAWSLatency()
+	awsLatency.Instrument(&cfg)
 
-	sqsClient := sqs.NewFromConfig(cfg)
+	sqsClient := storage.NewSQSClient(cfg, awsSettings)
+	store := storage.NewObjectStore(cfg, awsSettings)
+
+	workerID := os.Getenv("WORKER_ID")
+	if workerID == "" {
+		workerID, _ = os.Hostname()
+	}
+	tracker := metrics.NewWorkerTracker(db, workerID)
+	go tracker.Run(context.Background(), 15*time.Second)
+
+	collector := &metrics.Collector{DB: db, SQS: sqsClient, QueueURL: queueURL, AWSLatency: awsLatency}
+	go serveMetrics(collector, tracker)
+
+	go cleanup.NewDeletionRunner(db, store).Run(context.Background(), 30*time.Second)
+
+	retentionInterval, err := time.ParseDuration(os.Getenv("RETENTION_INTERVAL"))
+	if err != nil || retentionInterval <= 0 {
+		retentionInterval = time.Hour
+	}
+	go cleanup.NewRetentionRunner(db, store, cleanup.LoadRetentionPolicy()).Run(context.Background(), retentionInterval)
 
 	log.Println("Worker started. Polling SQS for messages...")
 
@@ -57,7 +79,10 @@ func main() {
 			}
 
 			log.Printf("Processing video ID: %d", payload.VideoID)
-			if err := processVideo(context.TODO(), db, payload.VideoID); err != nil {
+			tracker.Start()
+			err := processVideo(context.TODO(), db, store, payload.VideoID)
+			tracker.Done(err)
+			if err != nil {
 				log.Printf("Error processing video %d: %v", payload.VideoID, err)
 			}
 
@@ -73,7 +98,32 @@ func main() {
 	}
 }
 
-func processVideo(ctx context.Context, db *gorm.DB, videoID uint) error {
+// serveMetrics exposes the processing signals in Prometheus format so
+// scaling policies can scrape the worker directly.
+func serveMetrics(collector *metrics.Collector, tracker *metrics.WorkerTracker) {
+	addr := os.Getenv("WORKER_METRICS_ADDR")
+	if addr == "" {
+		addr = ":9091"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		stats, err := collector.Collect(req.Context(), time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.WritePrometheus(w, stats, tracker)
+	})
+
+	log.Printf("Worker metrics listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Worker metrics server stopped: %v", err)
+	}
+}
+
+func processVideo(ctx context.Context, db *gorm.DB, store *storage.ObjectStore, videoID uint) error {
 	startTime := time.Now()
 	log.Printf("[Video %d] Started processing at: %s", videoID, startTime.Format(time.RFC3339))
 	defer func() {
@@ -88,18 +138,30 @@ func processVideo(ctx context.Context, db *gorm.DB, videoID uint) error {
 		return err
 	}
 
+	// Messages can be delivered more than once (requeued or redelivered)
+	if video.Status != nil && *video.Status == "processed" {
+		log.Printf("[Video %d] Already processed, skipping", videoID)
+		return nil
+	}
+
 	// Prepare temp paths
 	tempInputPath := filepath.Join(os.TempDir(), fmt.Sprintf("input_%d.mp4", videoID))
 	tempOutputPath := filepath.Join(os.TempDir(), fmt.Sprintf("%d_processed.mp4", videoID))
+	tempThumbPath := filepath.Join(os.TempDir(), fmt.Sprintf("%d_thumb.jpg", videoID))
 	defer os.Remove(tempInputPath)
 	defer os.Remove(tempOutputPath)
+	defer os.Remove(tempThumbPath)
 	os.Remove("intro.mp4")
 	os.Remove("main.mp4")
 	os.Remove("outro.mp4")
 	os.Remove("files.txt")
 
-	// Download original video
-	if err := downloadFromS3(*video.OriginalURL, tempInputPath); err != nil {
+	if video.OriginalKey == nil {
+		return fmt.Errorf("video %d has no original object", videoID)
+	}
+
+	// Download original video through the authenticated SDK
+	if err := store.Download(ctx, *video.OriginalKey, tempInputPath); err != nil {
 		return fmt.Errorf("error downloading from S3: %w", err)
 	}
 
@@ -127,58 +189,58 @@ rm -f intro.mp4 main.mp4 outro.mp4 files.txt
 	}
 
 	// Upload processed video to S3
-	bucketName := os.Getenv("S3_BUCKET")
-	region := os.Getenv("AWS_REGION")
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	if err != nil {
-		return fmt.Errorf("error loading AWS config: %w", err)
-	}
-	client := s3.NewFromConfig(cfg)
-
 	f, err := os.Open(tempOutputPath)
 	if err != nil {
 		return fmt.Errorf("error opening processed file: %w", err)
 	}
 	defer f.Close()
 
-	objectKey := fmt.Sprintf("processed/%d_processed.mp4", videoID)
-	if _, err := client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &objectKey,
-		Body:   f,
-	}); err != nil {
+	objectKey := video.DerivedPrefix() + "processed.mp4"
+	if err := store.Upload(ctx, objectKey, f, "video/mp4"); err != nil {
 		return fmt.Errorf("error uploading to S3: %w", err)
 	}
 
-	publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, region, objectKey)
-	status := "processed"
-	now := time.Now()
-	video.Status = &status
-	video.ProcessedURL = &publicURL
-	video.ProcessedAt = &now
-	if err := db.Save(&video).Error; err != nil {
+	// The thumbnail is optional: the video is published without it if it fails
+	var thumbnailKey *string
+	if key, err := uploadThumbnail(ctx, store, video, tempOutputPath, tempThumbPath); err != nil {
+		log.Printf("[Video %d] Error generating thumbnail: %v", videoID, err)
+	} else {
+		thumbnailKey = &key
+	}
+
+	// Only the processing columns are written, so votes counted meanwhile
+	// are kept
+	if err := db.Model(&video).Updates(map[string]interface{}{
+		"status":        "processed",
+		"processed_key": objectKey,
+		"processed_at":  time.Now(),
+		"thumbnail_key": thumbnailKey,
+	}).Error; err != nil {
 		return fmt.Errorf("error updating DB: %w", err)
 	}
 
 	return nil
 }
 
-func downloadFromS3(s3URL, localPath string) error {
-	resp, err := http.Get(s3URL)
-	if err != nil {
-		return fmt.Errorf("error downloading from S3: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+// uploadThumbnail stores a frame of the processed video, taken after the
+// intro, next to the processed output.
+func uploadThumbnail(ctx context.Context, store *storage.ObjectStore, video models.Video, processedPath, thumbPath string) (string, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-ss", "3", "-i", processedPath,
+		"-frames:v", "1", "-vf", "scale=480:-2", thumbPath, "-y")
+	if err := cmd.Run(); err != nil {
+		return "", err
 	}
-	out, err := os.Create(localPath)
+
+	f, err := os.Open(thumbPath)
 	if err != nil {
-		return fmt.Errorf("error creating local file: %w", err)
+		return "", err
 	}
-	defer out.Close()
-	if _, err = io.Copy(out, resp.Body); err != nil {
-		return fmt.Errorf("error copying file content: %w", err)
+	defer f.Close()
+
+	key := video.DerivedPrefix() + "thumb.jpg"
+	if err := store.Upload(ctx, key, f, "image/jpeg"); err != nil {
+		return "", err
 	}
-	return nil
+	return key, nil
 }
@@ -68,7 +68,7 @@ const docTemplate = `{
         },
         "/create_video": {
             "post": {
-                "description": "Un usuario tipo player autenticado, puede subir un video",
+                "description": "Un usuario tipo player autenticado, puede subir un video. Si ya subió el mismo contenido se devuelve su video existente (duplicate: true)",
                 "produces": [
                     "application/json"
                 ],
@@ -85,6 +85,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/models.Video"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Prioridad de procesamiento (normal, low)",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Concurso al que se inscribe el video",
+                        "name": "contest_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -96,113 +108,513 @@ const docTemplate = `{
                                 "$ref": "#/definitions/models.Video"
                             }
                         }
+                    },
+                    "403": {
+                        "description": "Cuota de almacenamiento o de videos por concurso agotada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Archivo rechazado por el análisis antivirus",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Cuota diaria de cargas agotada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Cola de procesamiento saturada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
-        "/public/rankings": {
+        "/create_video_test": {
+            "post": {
+                "description": "Registra el video en estado ingesting y lo descarga en segundo plano. Solo se aceptan URLs http(s) públicas; el estado se consulta en /videos/{video_id}",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "videos"
+                ],
+                "summary": "Carga un video desde una URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "URL del video",
+                        "name": "video_url",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Título del video",
+                        "name": "title",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Concurso al que se inscribe el video",
+                        "name": "contest_id",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.Video"
+                        }
+                    },
+                    "403": {
+                        "description": "Cuota de almacenamiento o de videos por concurso agotada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Cuota diaria de cargas agotada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Cola de procesamiento saturada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/health/check": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "Healh check passed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/me/quota": {
+            "get": {
+                "description": "Límites configurados, consumo actual y saldo disponible (null = sin límite). La cuota diaria es una ventana móvil de 24 horas",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Consulta las cuotas de carga del usuario",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Concurso para el límite de videos por concurso",
+                        "name": "contest_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/quota.Remaining"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics/processing": {
+            "get": {
+                "description": "Profundidad de la cola, antigüedad del video pendiente más viejo, trabajos en curso por worker y p50/p95 desde la carga hasta el procesamiento",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Obtiene las métricas de procesamiento para autoescalado",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "1h",
+                        "description": "Ventana para los percentiles (ej. 15m, 1h)",
+                        "name": "window",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/metrics.ProcessingStats"
+                        }
+                    }
+                }
+            }
+        },
+        "/public/contests/{contestId}/standings": {
             "get": {
+                "description": "Ranking congelado al cerrar la votación del concurso, que no cambia con votos posteriores. Los videos se ordenan según la estrategia del concurso (score); los jugadores, por sus votos agregados",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "rankings"
                 ],
-                "summary": "Obtiene los rankings de los videos votados",
+                "summary": "Posiciones finales de un concurso",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del concurso",
+                        "name": "contestId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "video (por defecto) o player",
+                        "name": "scope",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.RankingView"
+                                "$ref": "#/definitions/models.RankingSnapshot"
                             }
                         }
+                    },
+                    "409": {
+                        "description": "El concurso aún no tiene posiciones finales",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
-        "/public/videos": {
+        "/public/rankings": {
             "get": {
+                "description": "El puntaje de cada jugador agrega los votos de sus videos procesados según mode: sum (todos), max (su mejor video) o best (sus n mejores videos). Sin mode se usa el configurado.\nLos filtros se aplican antes de calcular las posiciones. Desempate: jugadores con el mismo puntaje comparten la posición (1, 1, 3) y se listan por id de usuario ascendente.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "videos"
+                    "rankings"
+                ],
+                "summary": "Obtiene el ranking de jugadores",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Agregación de votos (sum, max, best)",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Videos contados por jugador en mode=best",
+                        "name": "n",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ciudad del jugador",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "País del jugador",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Concurso de los videos",
+                        "name": "contest_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tipo de usuario del jugador",
+                        "name": "user_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Tamaño de página (por defecto 50, máximo 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posición desde la que se lista",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "data": {
+                                    "type": "array",
+                                    "items": {
+                                        "$ref": "#/definitions/models.RankingView"
+                                    }
+                                },
+                                "message": {
+                                    "type": "string"
+                                },
+                                "mode": {
+                                    "type": "string"
+                                },
+                                "pagination": {
+                                    "$ref": "#/definitions/repository.RankingPage"
+                                }
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/public/rankings/players/{userId}/history": {
+            "get": {
+                "description": "Serie de posiciones y votos del jugador dentro de un concurso (sin contest_id, los videos fuera de concurso). trend compara el último snapshot con el de 24 horas antes (rankChange positivo = subió)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rankings"
+                ],
+                "summary": "Historial de posiciones de un jugador",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del jugador",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Concurso",
+                        "name": "contest_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Inicio de la serie (RFC 3339, por defecto 30 días atrás)",
+                        "name": "since",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Obtiene todos los videos disponibles para votar",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Video"
+                                "$ref": "#/definitions/models.RankingSnapshot"
                             }
                         }
                     }
                 }
             }
         },
-        "/public/videos/:videoId/vote": {
-            "post": {
+        "/public/rankings/stream": {
+            "get": {
+                "description": "Server-Sent Events. Al conectarse se envía un evento snapshot con las primeras posiciones, ordenadas según la estrategia configurada (score); luego, cada ráfaga de votos o reproducciones genera un evento update con los videos que cambiaron de posición o de votos (previousRank/previousVotes) y los que salieron (removed). Si el cliente se atrasa la conexión se cierra y debe reconectarse.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "rankings"
+                ],
+                "summary": "Recibe en vivo los cambios del ranking de videos",
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            }
+        },
+        "/public/rankings/videos": {
+            "get": {
+                "description": "Videos procesados ordenados según strategy: raw (votos), trending (votos / (horas desde su publicación + 2)^gravedad, para que los videos recientes puedan superar a los antiguos) o bayesian ((votos + C·m) / (vistas + C), donde m es la tasa de votos por vista de todos los videos y C las vistas previas configuradas, para que pocos votos con pocas vistas no encabecen el ranking).\nSin strategy se usa la del concurso de contest_id y, si no tiene, la configurada. score es el puntaje con el que se ordena.\nLos filtros se aplican antes de calcular las posiciones. Desempate: videos con el mismo puntaje comparten la posición (1, 1, 3) y se listan por id de video ascendente (el más antiguo primero).",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "votes"
+                    "rankings"
                 ],
-                "summary": "Un usuario autenticado puede votar por un video",
+                "summary": "Obtiene el ranking de videos",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Orden del ranking (raw, trending, bayesian)",
+                        "name": "strategy",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ciudad del jugador",
+                        "name": "city",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "País del jugador",
+                        "name": "country",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Concurso del video",
+                        "name": "contest_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tipo de usuario del jugador",
+                        "name": "user_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Tamaño de página (por defecto 50, máximo 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posición desde la que se lista",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "properties": {
+                                "data": {
+                                    "type": "array",
+                                    "items": {
+                                        "$ref": "#/definitions/models.VideoRanking"
+                                    }
+                                },
+                                "message": {
+                                    "type": "string"
+                                },
+                                "pagination": {
+                                    "$ref": "#/definitions/repository.RankingPage"
+                                },
+                                "strategy": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/public/rankings/videos/{videoId}/history": {
+            "get": {
+                "description": "Serie de posiciones, votos y puntaje del video dentro de su concurso, ordenado según la estrategia del concurso, tomada de los snapshots periódicos y finales. trend compara el último snapshot con el de 24 horas antes (rankChange positivo = subió)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "rankings"
+                ],
+                "summary": "Historial de posiciones de un video",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "ID del video",
-                        "name": "id",
+                        "name": "videoId",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Inicio de la serie (RFC 3339, por defecto 30 días atrás)",
+                        "name": "since",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "voto registrado con exito",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.RankingSnapshot"
+                            }
                         }
                     }
                 }
             }
         },
-        "/videos": {
+        "/public/videos": {
             "get": {
+                "description": "Cada video incluye solo la identidad pública de su jugador (handle, nombre público, ciudad y país)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "videos"
                 ],
-                "summary": "Obtiene todos los videos del usuario autenticado",
+                "summary": "Obtiene todos los videos disponibles para votar",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Video"
+                                "$ref": "#/definitions/models.PublicVideo"
                             }
                         }
                     }
                 }
             }
         },
-        "/videos/:video_id": {
+        "/public/videos/:videoId/vote": {
             "get": {
+                "description": "Si votó, retraction indica por qué no puede retirar el voto (null si puede). Si no votó, vote indica por qué no puede votar (ausente si puede)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "videos"
+                    "votes"
                 ],
-                "summary": "Obtiene un video por id",
+                "summary": "Indica si el usuario autenticado votó por un video",
                 "parameters": [
                     {
                         "type": "integer",
@@ -216,19 +628,21 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Video"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     }
                 }
             },
-            "delete": {
+            "post": {
+                "description": "Solo se puede votar por videos procesados de otros usuarios, dentro de la ventana de votación del concurso. Cada rechazo devuelve un code distinto (video_not_found, video_not_votable, self_vote, voter_type_not_allowed, account_too_new, voting_not_started, voting_closed, contest_finalized)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "videos"
+                    "votes"
                 ],
-                "summary": "Elimina un video por id",
+                "summary": "Un usuario autenticado puede votar por un video",
                 "parameters": [
                     {
                         "type": "integer",
@@ -240,26 +654,633 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "video eliminado",
+                        "description": "voto registrado con exito",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "El usuario no puede votar por este video",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Video no encontrado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Ya votaste por este video o el video no está procesado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "El voto fue retirado hace poco, reintentar luego de Retry-After",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            }
-        }
-    },
-    "definitions": {
-        "models.RankingView": {
-            "type": "object",
-            "properties": {
-                "city": {
+            },
+            "delete": {
+                "description": "No se permite si la votación del concurso del video ya cerró (configurable) ni, en ningún caso, después de tomadas sus posiciones finales. Retirar un voto no tiene espera, pero volver a votar sí respeta el intervalo mínimo",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "votes"
+                ],
+                "summary": "Retira el voto del usuario autenticado sobre un video",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del video",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Voto retirado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "El retiro de votos está deshabilitado, el concurso cerró o ya tiene posiciones finales",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "No has votado por este video",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/public/videos/{videoId}/views": {
+            "post": {
+                "description": "Las reproducciones son la exposición con la que el ranking bayesiano pondera los votos. Cada usuario cuenta una sola vez por video y las solicitudes por usuario están limitadas",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "videos"
+                ],
+                "summary": "Registra una reproducción de un video",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del video",
+                        "name": "videoId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Reproducción registrada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Falta token o token inválido",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Video no encontrado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Demasiadas solicitudes, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/uploads": {
+            "post": {
+                "description": "Devuelve una URL prefirmada (PUT) para subir el video directamente a S3 y el id de la carga",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Inicia una carga directa a almacenamiento",
+                "parameters": [
+                    {
+                        "description": "Datos del archivo a subir (size en bytes, checksum_sha256 obligatorio en base64)",
+                        "name": "upload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/repository.UploadRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Prioridad de procesamiento (normal, low)",
+                        "name": "priority",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Upload"
+                        }
+                    },
+                    "400": {
+                        "description": "Datos del archivo inválidos o sin checksum_sha256",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Cuota de almacenamiento o de videos por concurso agotada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Cuota diaria de cargas agotada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Cola de procesamiento saturada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/uploads/tus": {
+            "post": {
+                "description": "Requiere Upload-Length; Upload-Metadata admite filename, filetype, title y contest_id",
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Crea una carga reanudable (tus 1.0)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Tamaño total en bytes",
+                        "name": "Upload-Length",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metadatos tus (clave valor-base64)",
+                        "name": "Upload-Metadata",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Prioridad de procesamiento (normal, low)",
+                        "name": "priority",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created"
+                    },
+                    "403": {
+                        "description": "Cuota de almacenamiento o de videos por concurso agotada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Cuota diaria de cargas agotada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "options": {
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Capacidades del servidor tus",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                }
+            }
+        },
+        "/uploads/tus/{upload_id}": {
+            "delete": {
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Cancela una carga reanudable",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID de la carga",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                }
+            },
+            "head": {
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Consulta el avance de una carga reanudable",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID de la carga",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    }
+                }
+            },
+            "patch": {
+                "description": "El cuerpo (application/offset+octet-stream) se agrega en Upload-Offset y se envía a S3 como partes de una carga multiparte; al recibir el último fragmento se completa la carga, se crea el video y se encola su procesamiento",
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Envía un fragmento de una carga reanudable",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID de la carga",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Posición del fragmento",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    }
+                }
+            }
+        },
+        "/uploads/{upload_id}/complete": {
+            "post": {
+                "description": "Verifica que el objeto exista con el tamaño y checksum declarados, crea el video y encola su procesamiento",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "uploads"
+                ],
+                "summary": "Completa una carga directa a almacenamiento",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID de la carga",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Video"
+                        }
+                    },
+                    "403": {
+                        "description": "Cuota de almacenamiento o de videos por concurso agotada",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Cuota diaria de cargas agotada, reintentar luego de Retry-After",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/videos": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "videos"
+                ],
+                "summary": "Obtiene todos los videos del usuario autenticado",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Video"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/videos/:video_id": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "videos"
+                ],
+                "summary": "Obtiene un video por id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del video",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Video"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "videos"
+                ],
+                "summary": "Elimina un video por id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID del video",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "video eliminado",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "metrics.AWSCallStats": {
+            "type": "object",
+            "properties": {
+                "avgSeconds": {
+                    "type": "number"
+                },
+                "calls": {
+                    "type": "integer"
+                },
+                "errors": {
+                    "type": "integer"
+                },
+                "maxSeconds": {
+                    "type": "number"
+                },
+                "operation": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "totalSeconds": {
+                    "type": "number"
+                }
+            }
+        },
+        "metrics.LatencyStats": {
+            "type": "object",
+            "properties": {
+                "p50Seconds": {
+                    "type": "number"
+                },
+                "p95Seconds": {
+                    "type": "number"
+                },
+                "samples": {
+                    "type": "integer"
+                },
+                "window": {
+                    "type": "string"
+                }
+            }
+        },
+        "metrics.ProcessingStats": {
+            "type": "object",
+            "properties": {
+                "awsCalls": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/metrics.AWSCallStats"
+                    }
+                },
+                "collectedAt": {
                     "type": "string"
                 },
-                "email": {
+                "jobsInFlight": {
+                    "type": "integer"
+                },
+                "oldestPendingAgeSeconds": {
+                    "type": "number"
+                },
+                "queueDelayed": {
+                    "type": "integer"
+                },
+                "queueDepth": {
+                    "type": "integer"
+                },
+                "queueInFlight": {
+                    "type": "integer"
+                },
+                "uploadToProcessed": {
+                    "$ref": "#/definitions/metrics.LatencyStats"
+                },
+                "workers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WorkerHeartbeat"
+                    }
+                }
+            }
+        },
+        "models.PublicPlayer": {
+            "type": "object",
+            "properties": {
+                "city": {
+                    "type": "string"
+                },
+                "country": {
+                    "type": "string"
+                },
+                "displayName": {
+                    "type": "string"
+                },
+                "handle": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.PublicVideo": {
+            "type": "object",
+            "properties": {
+                "User": {
+                    "$ref": "#/definitions/models.PublicPlayer"
+                },
+                "contestId": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "processedAt": {
+                    "type": "string"
+                },
+                "processedUrl": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "thumbnailUrl": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "views": {
+                    "type": "integer"
+                },
+                "votes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.RankingSnapshot": {
+            "type": "object",
+            "properties": {
+                "contestId": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "integer"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "score": {
+                    "description": "Puntaje con el que se ordenó: el de la estrategia del concurso para\nvideos y los votos agregados para jugadores",
+                    "type": "number"
+                },
+                "subjectId": {
+                    "type": "integer"
+                },
+                "takenAt": {
+                    "type": "string"
+                },
+                "votes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.RankingView": {
+            "type": "object",
+            "properties": {
+                "bestVideoId": {
+                    "type": "integer"
+                },
+                "bestVideoTitle": {
+                    "type": "string"
+                },
+                "city": {
+                    "type": "string"
+                },
+                "displayName": {
                     "type": "string"
                 },
-                "userID": {
+                "handle": {
+                    "type": "string"
+                },
+                "rank": {
+                    "description": "Posición (empates comparten posición), videos que suman al puntaje\ny el video con más votos del jugador",
+                    "type": "integer"
+                },
+                "userId": {
+                    "type": "integer"
+                },
+                "videos": {
                     "type": "integer"
                 },
                 "votes": {
@@ -267,6 +1288,56 @@ const docTemplate = `{
                 }
             }
         },
+        "models.Upload": {
+            "type": "object",
+            "properties": {
+                "checksumSha256": {
+                    "type": "string"
+                },
+                "contentType": {
+                    "type": "string"
+                },
+                "contestId": {
+                    "description": "Concurso al que se inscribe el video",
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lowPriority": {
+                    "type": "boolean"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "protocol": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "Relacion con User",
+                    "type": "integer"
+                },
+                "video_id": {
+                    "description": "Video creado al completar la carga",
+                    "type": "integer"
+                }
+            }
+        },
         "models.User": {
             "type": "object",
             "properties": {
@@ -276,12 +1347,23 @@ const docTemplate = `{
                 "country": {
                     "type": "string"
                 },
+                "createdAt": {
+                    "description": "Null for accounts created before it was recorded",
+                    "type": "string"
+                },
+                "displayName": {
+                    "type": "string"
+                },
                 "email": {
                     "type": "string"
                 },
                 "firstName": {
                     "type": "string"
                 },
+                "handle": {
+                    "description": "Identidad pública: los endpoints públicos muestran solo estos datos",
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -296,9 +1378,21 @@ const docTemplate = `{
         "models.Video": {
             "type": "object",
             "properties": {
+                "checksumSha256": {
+                    "description": "SHA-256 (hex) del original, calculado al recibirlo. Único por usuario:\notra carga del mismo contenido devuelve el video existente",
+                    "type": "string"
+                },
+                "contestId": {
+                    "description": "Concurso al que se inscribió el video",
+                    "type": "integer"
+                },
                 "createdAt": {
                     "type": "string"
                 },
+                "duplicateOf": {
+                    "description": "Video de otro usuario con el mismo contenido; queda marcado para revisión",
+                    "type": "integer"
+                },
                 "id": {
                     "type": "integer"
                 },
@@ -309,11 +1403,25 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "processedUrl": {
+                    "description": "URLs firmadas de corta duración, generadas al responder",
                     "type": "string"
                 },
+                "reviewReason": {
+                    "type": "string"
+                },
+                "sizeBytes": {
+                    "type": "integer"
+                },
                 "status": {
                     "type": "string"
                 },
+                "statusReason": {
+                    "description": "Motivo del estado cuando el video no pudo continuar (ingesta fallida, rechazo)",
+                    "type": "string"
+                },
+                "thumbnailUrl": {
+                    "type": "string"
+                },
                 "title": {
                     "type": "string"
                 },
@@ -323,6 +1431,131 @@ const docTemplate = `{
                 "user_id": {
                     "description": "Relacion con User",
                     "type": "integer"
+                },
+                "views": {
+                    "description": "Usuarios distintos que reprodujeron el video (video_views), la\nexposición del ranking bayesiano",
+                    "type": "integer"
+                },
+                "votes": {
+                    "description": "Votos del video, actualizado en la misma transacción que cada voto",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.VideoRanking": {
+            "type": "object",
+            "properties": {
+                "city": {
+                    "type": "string"
+                },
+                "displayName": {
+                    "type": "string"
+                },
+                "handle": {
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "integer"
+                },
+                "score": {
+                    "description": "Puntaje según la estrategia del ranking; con raw son los votos",
+                    "type": "number"
+                },
+                "thumbnailUrl": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "userId": {
+                    "description": "Jugador que subió el video",
+                    "type": "integer"
+                },
+                "videoId": {
+                    "type": "integer"
+                },
+                "views": {
+                    "type": "integer"
+                },
+                "votes": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.WorkerHeartbeat": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "type": "integer"
+                },
+                "inFlight": {
+                    "type": "integer"
+                },
+                "lastSeenAt": {
+                    "type": "string"
+                },
+                "processed": {
+                    "type": "integer"
+                },
+                "startedAt": {
+                    "type": "string"
+                },
+                "workerId": {
+                    "type": "string"
+                }
+            }
+        },
+        "quota.Remaining": {
+            "type": "object",
+            "properties": {
+                "totalBytes": {
+                    "type": "integer"
+                },
+                "uploadsToday": {
+                    "type": "integer"
+                },
+                "videosInContest": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.RankingPage": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "next_offset": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.UploadRequest": {
+            "type": "object",
+            "properties": {
+                "checksum_sha256": {
+                    "type": "string"
+                },
+                "content_type": {
+                    "type": "string"
+                },
+                "contest_id": {
+                    "type": "integer"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,284 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL       = errors.New("url must be an absolute http or https url")
+	ErrBlockedAddress   = errors.New("url resolves to a private or reserved address")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrTooLarge         = errors.New("remote file exceeds the maximum size")
+	ErrNotVideo         = errors.New("remote file is not a video")
+)
+
+// Config holds the limits applied to every remote download.
+type Config struct {
+	MaxBytes     int64
+	Timeout      time.Duration
+	MaxRedirects int
+	Concurrency  int
+}
+
+// LoadConfig reads the limits from the environment.
+func LoadConfig() Config {
+	return Config{
+		MaxBytes:     envInt("INGEST_MAX_BYTES", 100*1024*1024),
+		Timeout:      envDuration("INGEST_TIMEOUT", 5*time.Minute),
+		MaxRedirects: int(envInt("INGEST_MAX_REDIRECTS", 3)),
+		Concurrency:  int(envInt("INGEST_CONCURRENCY", 4)),
+	}
+}
+
+// Fetcher downloads user supplied URLs. Addresses are checked when each
+// connection is dialed, after DNS resolution, so neither redirects nor DNS
+// rebinding can reach private networks or the cloud metadata endpoint.
+type Fetcher struct {
+	Config Config
+
+	client *http.Client
+	slots  chan struct{}
+}
+
+func NewFetcher(cfg Config) *Fetcher {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || IsBlocked(addr) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// No proxy: a proxy would dial on our behalf and skip the check
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConns:          cfg.Concurrency,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if _, err := ValidateURL(req.URL.String()); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	return &Fetcher{Config: cfg, client: client, slots: make(chan struct{}, cfg.Concurrency)}
+}
+
+// Download is the body of a remote video. The caller must close it.
+type Download struct {
+	Body        io.ReadCloser
+	ContentType string
+}
+
+// Acquire waits for a free download slot. Release must be called after the
+// download finishes.
+func (f *Fetcher) Acquire(ctx context.Context) error {
+	select {
+	case f.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Fetcher) Release() {
+	<-f.slots
+}
+
+// Fetch starts downloading rawURL. The content type is sniffed from the first
+// bytes rather than trusted from the response, and reading past MaxBytes
+// fails with ErrTooLarge.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Download, error) {
+	target, err := ValidateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		for _, known := range []error{ErrBlockedAddress, ErrTooManyRedirects, ErrInvalidURL} {
+			if errors.Is(err, known) {
+				return nil, known
+			}
+		}
+		return nil, fmt.Errorf("error downloading %s: %w", target.Redacted(), err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error downloading %s: status %d", target.Redacted(), resp.StatusCode)
+	}
+	if resp.ContentLength > f.Config.MaxBytes {
+		resp.Body.Close()
+		return nil, ErrTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error downloading %s: %w", target.Redacted(), err)
+	}
+	head = head[:n]
+
+	contentType, ok := SniffVideo(head)
+	if !ok {
+		resp.Body.Close()
+		return nil, ErrNotVideo
+	}
+
+	body := &limitedBody{
+		r:         io.MultiReader(bytes.NewReader(head), resp.Body),
+		closer:    resp.Body,
+		remaining: f.Config.MaxBytes,
+	}
+	return &Download{Body: body, ContentType: contentType}, nil
+}
+
+// ValidateURL accepts absolute http and https URLs only.
+func ValidateURL(rawURL string) (*url.URL, error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, ErrInvalidURL
+	}
+	if target.User != nil {
+		return nil, ErrInvalidURL
+	}
+	return target, nil
+}
+
+// Ranges not covered by netip: shared address space (RFC 6598), "this
+// network", benchmarking (RFC 2544), reserved class E and broadcast, and the
+// NAT64 prefixes (RFC 6052, RFC 8215), which reach IPv4 hosts through a
+// translator and could be used to reach the blocked IPv4 ranges
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// IsBlocked reports whether addr is loopback, private, link-local (which
+// includes 169.254.169.254), multicast or otherwise not publicly routable.
+func IsBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SniffVideo detects the content type of the first bytes of a file and
+// reports whether it is a video container.
+func SniffVideo(head []byte) (string, bool) {
+	contentType := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(contentType, "video/"):
+		return contentType, true
+	case contentType == "application/ogg":
+		return "video/ogg", true
+	}
+
+	// ISO base media files whose brand the standard sniffer does not know
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if string(head[8:12]) == "qt  " {
+			return "video/quicktime", true
+		}
+		return "video/mp4", true
+	}
+	// Matroska shares the EBML header with WebM
+	if bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}) {
+		return "video/x-matroska", true
+	}
+
+	return contentType, false
+}
+
+// limitedBody fails once more than remaining bytes have been read.
+type limitedBody struct {
+	r         io.Reader
+	closer    io.Closer
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.closer.Close()
+}
+
+func envInt(key string, def int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"back-end-todolist/backpressure"
 	"back-end-todolist/bootstrap"
+	"back-end-todolist/ingest"
+	"back-end-todolist/metrics"
 	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"back-end-todolist/ranking"
 	"back-end-todolist/repository"
+	"back-end-todolist/scan"
+	"back-end-todolist/storage"
+	"back-end-todolist/voting"
+	"context"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,56 +27,99 @@ func main() {
 	errMigrateUsers := models.MigrateUsers(db)
 	errMigrateVideos := models.MigrateVideos(db)
 	errMigrateVotes := models.MigrateVotes(db)
+	errMigrateHeartbeats := models.MigrateWorkerHeartbeats(db)
+	errMigrateUploads := models.MigrateUploads(db)
+	errMigrateDeletions := models.MigrateStorageDeletions(db)
+	errMigrateContests := models.MigrateContests(db)
+	errMigrateRetention := models.MigrateRetentionActions(db)
+	errMigrateRankings := models.MigrateRankings(db)
+	errMigrateSnapshots := models.MigrateRankingSnapshots(db)
 
-	if errMigrateUsers != nil || errMigrateVideos != nil || errMigrateVotes != nil {
+	if errMigrateUsers != nil || errMigrateVideos != nil || errMigrateVotes != nil || errMigrateHeartbeats != nil || errMigrateUploads != nil || errMigrateDeletions != nil || errMigrateContests != nil || errMigrateRetention != nil || errMigrateRankings != nil || errMigrateSnapshots != nil {
 		log.Fatal("Error migrando la base de datos")
 	}
 
-	// Crear vista materializada
-	createView := `
-		CREATE MATERIALIZED VIEW IF NOT EXISTS ranking_view AS
-		SELECT
-			u.id AS user_id,
-			u.email,
-			u.city,
-			COUNT(vt.video_id) AS votes
-		FROM videos v
-		JOIN users u ON v.user_id = u.id
-		LEFT JOIN votes vt ON v.id = vt.video_id
-		GROUP BY u.id, u.email, u.city
-		ORDER BY votes DESC;
-		`
-	if err := db.Exec(createView).Error; err != nil {
-		log.Printf("No se pudo crear la vista materializada: %v", err)
-	} else {
-		log.Println("Vista materializada ranking_view creada (si no existía)")
+	// Los clientes de AWS se crean una sola vez y se comparten entre peticiones
+	awsSettings := storage.LoadAWSSettings()
+	cfg, err := storage.LoadAWSConfig(context.TODO(), awsSettings)
+	if err != nil {
+		log.Fatalf("Error loading AWS config: %v", err)
+	}
+	awsLatency := metrics.NewAWSLatency()
+	awsLatency.Instrument(&cfg)
+
+	sqsClient := storage.NewSQSClient(cfg, awsSettings)
+	queueURL := os.Getenv("SQS_QUEUE_URL")
+
+	collector := &metrics.Collector{
+		DB:         db,
+		SQS:        sqsClient,
+		QueueURL:   queueURL,
+		AWSLatency: awsLatency,
+	}
 
+	r := repository.Repository{
+		DB:           db,
+		Store:        storage.NewObjectStore(cfg, awsSettings),
+		SQS:          sqsClient,
+		QueueURL:     queueURL,
+		Metrics:      collector,
+		Backpressure: backpressure.NewGate(backpressure.LoadConfig(), collector.QueueBacklog),
+		Ingest:       ingest.NewFetcher(ingest.LoadConfig()),
+		Scanner:      scan.FromEnv(),
+		Quota:        quota.LoadLimits(),
+		Voting:       voting.LoadRules(),
+		VotePolicy:   voting.LoadPolicy(),
+		Ranking:      ranking.LoadConfig(),
 	}
 
-	createIndex := `
-	CREATE UNIQUE INDEX IF NOT EXISTS idx_ranking_view_user ON ranking_view(user_id);
-	`
-	if err := db.Exec(createIndex).Error; err != nil {
-		log.Printf("No se pudo crear índice de ranking_view: %v", err)
-	} else {
-		log.Println("Índice ranking_view creado (si no existía)")
+	// Cambios del ranking en vivo; cada instancia escucha los votos de todas
+	r.RankingStream = ranking.NewStream(db, r.Ranking)
+	go r.RankingStream.Run(context.Background())
+
+	// El ranking de jugadores se recalcula a lo sumo una vez por ventana de
+	// debounce y combinación de filtros
+	r.PlayerRankings = ranking.NewCache[[]models.RankingView](r.Ranking.StreamDebounce, 1000)
+
+	// Los contadores de votos se mantienen en cada voto; la reconciliación
+	// corrige desvíos y corre en una sola instancia a la vez (advisory lock)
+	if r.Ranking.ReconcileInterval > 0 {
+		go ranking.NewReconciler(db).Run(context.Background(), r.Ranking.ReconcileInterval)
 	}
 
-	// Refrescar la vista materializada cada 2 minutos en segundo plano
+	// Historial del ranking y posiciones finales al cierre de cada concurso;
+	// cada minuto se revisa si corresponde tomar un snapshot
+	go ranking.NewSnapshotter(db, r.Ranking.SnapshotInterval, r.Ranking).Run(context.Background(), time.Minute)
+
+	// Encolar cada minuto los videos guardados cuyo envío a SQS falló
 	go func() {
-		ticker := time.NewTicker(2 * time.Minute)
+		ticker := time.NewTicker(time.Minute)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			if err := db.Exec("REFRESH MATERIALIZED VIEW ranking_view;").Error; err != nil {
-				log.Println("Error refrescando ranking_view:", err)
-			} else {
-				log.Println("ranking_view refrescada con éxito ✅")
+			if requeued, err := r.RequeueStrandedVideos(context.Background()); err != nil {
+				log.Println("Error reencolando videos pendientes:", err)
+			} else if requeued > 0 {
+				log.Printf("Videos reencolados: %d", requeued)
 			}
 		}
 	}()
 
-	r := repository.Repository{DB: db}
+	// Descartar cada 10 minutos las cargas abandonadas y retomar las ingestas
+	// interrumpidas
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := r.ExpireUploads(context.Background()); err != nil {
+				log.Println("Error expirando cargas abandonadas:", err)
+			}
+			if err := r.RetryStaleIngestions(context.Background()); err != nil {
+				log.Println("Error retomando ingestas interrumpidas:", err)
+			}
+		}
+	}()
 
 	app := fiber.New(fiber.Config{
 		BodyLimit:         100 * 1024 * 1024,
@@ -75,9 +128,9 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000, http://127.0.0.1:3000",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Authorization",
-		ExposeHeaders:    "Content-Type",
+		AllowMethods:     "GET,POST,PUT,PATCH,HEAD,DELETE,OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata",
+		ExposeHeaders:    "Content-Type, Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Upload-Video-Id",
 		AllowCredentials: true,
 	}))
 
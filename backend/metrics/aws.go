@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// AWSCallStats summarizes the calls this process made to one AWS operation.
+// Durations include retries, so they are what the caller waited for.
+type AWSCallStats struct {
+	Service      string  `json:"service"`
+	Operation    string  `json:"operation"`
+	Calls        int64   `json:"calls"`
+	Errors       int64   `json:"errors"`
+	TotalSeconds float64 `json:"totalSeconds"`
+	AvgSeconds   float64 `json:"avgSeconds"`
+	MaxSeconds   float64 `json:"maxSeconds"`
+}
+
+// AWSLatency records the latency of the AWS calls made by the clients it
+// instruments, to compare client settings under load.
+type AWSLatency struct {
+	mu    sync.Mutex
+	calls map[[2]string]*AWSCallStats
+}
+
+func NewAWSLatency() *AWSLatency {
+	return &AWSLatency{calls: map[[2]string]*AWSCallStats{}}
+}
+
+// Instrument adds the recording middleware to every client built from cfg.
+func (l *AWSLatency) Instrument(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AWSLatency",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, metadata, err := next.HandleInitialize(ctx, in)
+
+				// Presigning runs the same stack without sending a request
+				if err == nil && awsmiddleware.GetRawResponse(metadata) == nil {
+					return out, metadata, err
+				}
+
+				l.Observe(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), time.Since(start), err != nil)
+				return out, metadata, err
+			}), middleware.Before)
+	})
+}
+
+func (l *AWSLatency) Observe(service, operation string, elapsed time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := [2]string{service, operation}
+	stats, ok := l.calls[key]
+	if !ok {
+		stats = &AWSCallStats{Service: service, Operation: operation}
+		l.calls[key] = stats
+	}
+
+	seconds := elapsed.Seconds()
+	stats.Calls++
+	stats.TotalSeconds += seconds
+	stats.AvgSeconds = stats.TotalSeconds / float64(stats.Calls)
+	if seconds > stats.MaxSeconds {
+		stats.MaxSeconds = seconds
+	}
+	if failed {
+		stats.Errors++
+	}
+}
+
+// Snapshot returns the stats of every operation seen so far.
+func (l *AWSLatency) Snapshot() []AWSCallStats {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshot := make([]AWSCallStats, 0, len(l.calls))
+	for _, stats := range l.calls {
+		snapshot = append(snapshot, *stats)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Service != snapshot[j].Service {
+			return snapshot[i].Service < snapshot[j].Service
+		}
+		return snapshot[i].Operation < snapshot[j].Operation
+	})
+	return snapshot
+}
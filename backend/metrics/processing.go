@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"back-end-todolist/models"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"gorm.io/gorm"
+)
+
+// Workers that have not reported within this period are considered gone.
+const workerStaleAfter = 2 * time.Minute
+
+// Collector computes the processing signals shared by the API endpoint and
+// the worker metrics, so autoscaling and load-test reports read the same numbers.
+type Collector struct {
+	DB       *gorm.DB
+	SQS      *sqs.Client
+	QueueURL string
+
+	// Latency of this process's AWS calls; optional
+	AWSLatency *AWSLatency
+}
+
+type LatencyStats struct {
+	Window     string  `json:"window"`
+	Samples    int64   `json:"samples"`
+	P50Seconds float64 `json:"p50Seconds"`
+	P95Seconds float64 `json:"p95Seconds"`
+}
+
+// swagger:model
+type ProcessingStats struct {
+	QueueDepth              int64                    `json:"queueDepth"`
+	QueueInFlight           int64                    `json:"queueInFlight"`
+	QueueDelayed            int64                    `json:"queueDelayed"`
+	OldestPendingAgeSeconds float64                  `json:"oldestPendingAgeSeconds"`
+	JobsInFlight            int64                    `json:"jobsInFlight"`
+	Workers                 []models.WorkerHeartbeat `json:"workers"`
+	UploadToProcessed       LatencyStats             `json:"uploadToProcessed"`
+	AWSCalls                []AWSCallStats           `json:"awsCalls"`
+	CollectedAt             time.Time                `json:"collectedAt"`
+}
+
+func (c *Collector) Collect(ctx context.Context, window time.Duration) (*ProcessingStats, error) {
+	now := time.Now()
+	stats := &ProcessingStats{CollectedAt: now, AWSCalls: c.AWSLatency.Snapshot()}
+
+	if err := c.collectQueue(ctx, stats); err != nil {
+		return nil, err
+	}
+
+	// SQS does not expose the age of the oldest message, so it is taken from
+	// the oldest video that is still waiting to be processed.
+	var oldest *time.Time
+	if err := c.DB.WithContext(ctx).
+		Model(&models.Video{}).
+		Where("status IN ?", []string{"uploaded", "deferred"}).
+		Select("MIN(uploaded_at)").
+		Scan(&oldest).Error; err != nil {
+		return nil, fmt.Errorf("error reading oldest pending video: %w", err)
+	}
+	if oldest != nil {
+		stats.OldestPendingAgeSeconds = now.Sub(*oldest).Seconds()
+	}
+
+	if err := c.DB.WithContext(ctx).
+		Where("last_seen_at >= ?", now.Add(-workerStaleAfter)).
+		Order("worker_id").
+		Find(&stats.Workers).Error; err != nil {
+		return nil, fmt.Errorf("error reading worker heartbeats: %w", err)
+	}
+	for _, w := range stats.Workers {
+		stats.JobsInFlight += w.InFlight
+	}
+
+	latency, err := c.uploadToProcessed(ctx, now.Add(-window))
+	if err != nil {
+		return nil, err
+	}
+	latency.Window = window.String()
+	stats.UploadToProcessed = *latency
+
+	return stats, nil
+}
+
+func (c *Collector) collectQueue(ctx context.Context, stats *ProcessingStats) error {
+	if c.SQS == nil || c.QueueURL == "" {
+		return nil
+	}
+
+	out, err := c.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: &c.QueueURL,
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			types.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error reading queue attributes: %w", err)
+	}
+
+	stats.QueueDepth = parseAttribute(out.Attributes, types.QueueAttributeNameApproximateNumberOfMessages)
+	stats.QueueInFlight = parseAttribute(out.Attributes, types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)
+	stats.QueueDelayed = parseAttribute(out.Attributes, types.QueueAttributeNameApproximateNumberOfMessagesDelayed)
+
+	return nil
+}
+
+// QueueBacklog returns the messages waiting to be picked up by a worker,
+// including delayed ones.
+func (c *Collector) QueueBacklog(ctx context.Context) (int64, error) {
+	stats := &ProcessingStats{}
+	if err := c.collectQueue(ctx, stats); err != nil {
+		return 0, err
+	}
+	return stats.QueueDepth + stats.QueueDelayed, nil
+}
+
+func (c *Collector) uploadToProcessed(ctx context.Context, since time.Time) (*LatencyStats, error) {
+	latency := LatencyStats{}
+
+	err := c.DB.WithContext(ctx).Raw(`
+		SELECT
+			COUNT(*) AS samples,
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM processed_at - uploaded_at)), 0) AS p50_seconds,
+			COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM processed_at - uploaded_at)), 0) AS p95_seconds
+		FROM videos
+		WHERE status = 'processed'
+			AND uploaded_at IS NOT NULL
+			AND processed_at >= ?
+		`, since).Scan(&latency).Error
+	if err != nil {
+		return nil, fmt.Errorf("error computing processing latency: %w", err)
+	}
+
+	return &latency, nil
+}
+
+func parseAttribute(attrs map[string]string, name types.QueueAttributeName) int64 {
+	v, err := strconv.ParseInt(attrs[string(name)], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"back-end-todolist/models"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WorkerTracker counts the jobs a single worker is handling and publishes
+// them as a heartbeat row, so the API can report jobs in flight per worker.
+type WorkerTracker struct {
+	DB        *gorm.DB
+	WorkerID  string
+	startedAt time.Time
+	inFlight  atomic.Int64
+	processed atomic.Int64
+	failed    atomic.Int64
+}
+
+func NewWorkerTracker(db *gorm.DB, workerID string) *WorkerTracker {
+	return &WorkerTracker{DB: db, WorkerID: workerID, startedAt: time.Now()}
+}
+
+func (t *WorkerTracker) Start() {
+	t.inFlight.Add(1)
+}
+
+func (t *WorkerTracker) Done(err error) {
+	t.inFlight.Add(-1)
+	if err != nil {
+		t.failed.Add(1)
+	} else {
+		t.processed.Add(1)
+	}
+}
+
+func (t *WorkerTracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+func (t *WorkerTracker) Beat(ctx context.Context) error {
+	heartbeat := models.WorkerHeartbeat{
+		WorkerID:   t.WorkerID,
+		InFlight:   t.inFlight.Load(),
+		Processed:  t.processed.Load(),
+		Failed:     t.failed.Load(),
+		StartedAt:  t.startedAt,
+		LastSeenAt: time.Now(),
+	}
+
+	return t.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&heartbeat).Error
+}
+
+// Run publishes a heartbeat every interval until ctx is cancelled.
+func (t *WorkerTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Beat(ctx); err != nil {
+			log.Printf("Error publishing worker heartbeat: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WritePrometheus renders the shared processing stats, plus the local worker
+// counters when tracker is not nil, in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer, stats *ProcessingStats, tracker *WorkerTracker) {
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", name, help, name, name, value)
+	}
+
+	gauge("anb_queue_depth", "Approximate number of visible messages in the processing queue.", float64(stats.QueueDepth))
+	gauge("anb_queue_in_flight", "Approximate number of messages received but not yet deleted.", float64(stats.QueueInFlight))
+	gauge("anb_queue_delayed", "Approximate number of delayed messages in the processing queue.", float64(stats.QueueDelayed))
+	gauge("anb_oldest_pending_age_seconds", "Age of the oldest video waiting to be processed.", stats.OldestPendingAgeSeconds)
+	gauge("anb_jobs_in_flight", "Jobs being processed across all live workers.", float64(stats.JobsInFlight))
+	gauge("anb_upload_to_processed_p50_seconds", "Median time from upload to processed.", stats.UploadToProcessed.P50Seconds)
+	gauge("anb_upload_to_processed_p95_seconds", "95th percentile time from upload to processed.", stats.UploadToProcessed.P95Seconds)
+
+	fmt.Fprintf(w, "# HELP anb_worker_jobs_in_flight Jobs being processed per worker.\n# TYPE anb_worker_jobs_in_flight gauge\n")
+	for _, worker := range stats.Workers {
+		fmt.Fprintf(w, "anb_worker_jobs_in_flight{worker=%q} %d\n", worker.WorkerID, worker.InFlight)
+	}
+
+	if len(stats.AWSCalls) > 0 {
+		fmt.Fprintf(w, "# HELP anb_aws_request_seconds Latency of the AWS calls made by this process, including retries.\n# TYPE anb_aws_request_seconds summary\n")
+		for _, call := range stats.AWSCalls {
+			labels := fmt.Sprintf("service=%q,operation=%q", call.Service, call.Operation)
+			fmt.Fprintf(w, "anb_aws_request_seconds_sum{%s} %g\n", labels, call.TotalSeconds)
+			fmt.Fprintf(w, "anb_aws_request_seconds_count{%s} %d\n", labels, call.Calls)
+		}
+		fmt.Fprintf(w, "# HELP anb_aws_request_errors_total AWS calls that failed after every retry.\n# TYPE anb_aws_request_errors_total counter\n")
+		for _, call := range stats.AWSCalls {
+			fmt.Fprintf(w, "anb_aws_request_errors_total{service=%q,operation=%q} %d\n", call.Service, call.Operation, call.Errors)
+		}
+	}
+
+	if tracker != nil {
+		fmt.Fprintf(w, "# HELP anb_worker_jobs_total Jobs handled by this worker since it started.\n# TYPE anb_worker_jobs_total counter\n")
+		fmt.Fprintf(w, "anb_worker_jobs_total{worker=%q,result=\"processed\"} %d\n", tracker.WorkerID, tracker.processed.Load())
+		fmt.Fprintf(w, "anb_worker_jobs_total{worker=%q,result=\"failed\"} %d\n", tracker.WorkerID, tracker.failed.Load())
+	}
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// LimitPerUser allows each authenticated user max requests per window on the
+// route; it must run after AutValidation. Counters are kept per instance.
+func LimitPerUser(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if userID, ok := c.Locals("userID").(uint); ok {
+				return strconv.FormatUint(uint64(userID), 10)
+			}
+			return c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"message": "Demasiadas solicitudes, reintentar luego de Retry-After",
+			})
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Contest groups the videos submitted to one edition of the competition.
+// swagger:model
+type Contest struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      *string    `json:"name"`
+	StartsAt  *time.Time `json:"startsAt"`
+	EndsAt    *time.Time `gorm:"index" json:"endsAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+
+	// Voting window; each bound defaults to the contest's own
+	VotingStartsAt *time.Time `json:"votingStartsAt"`
+	VotingEndsAt   *time.Time `json:"votingEndsAt"`
+
+	// Vote eligibility overrides; nil keeps the default policy
+	AllowSelfVotes          *bool   `json:"allowSelfVotes"`
+	VoterTypes              *string `json:"voterTypes"` // comma separated user types
+	MinVoterAccountAgeHours *int    `json:"minVoterAccountAgeHours"`
+
+	// Orden del ranking de videos del concurso (raw, trending, bayesian);
+	// nil usa el configurado
+	RankingStrategy *string `json:"rankingStrategy"`
+
+	// Cuándo se congelaron las posiciones finales, al cerrar la votación;
+	// desde entonces no se aceptan votos ni retiros
+	FinalizedAt *time.Time `json:"finalizedAt"`
+}
+
+// Closed reports whether the contest ended before now.
+func (c Contest) Closed(now time.Time) bool {
+	return c.EndsAt != nil && c.EndsAt.Before(now)
+}
+
+// VotingClosed reports whether the contest's voting window ended before now.
+func (c Contest) VotingClosed(now time.Time) bool {
+	_, endsAt := c.VotingWindow()
+	return endsAt != nil && endsAt.Before(now)
+}
+
+// VotingWindow returns when the contest accepts votes.
+func (c Contest) VotingWindow() (*time.Time, *time.Time) {
+	startsAt, endsAt := c.StartsAt, c.EndsAt
+	if c.VotingStartsAt != nil {
+		startsAt = c.VotingStartsAt
+	}
+	if c.VotingEndsAt != nil {
+		endsAt = c.VotingEndsAt
+	}
+	return startsAt, endsAt
+}
+
+func MigrateContests(db *gorm.DB) error {
+
+	err := db.AutoMigrate(&Contest{})
+
+	return err
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContest_VotingClosed(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	cases := []struct {
+		name    string
+		contest Contest
+		closed  bool
+	}{
+		{"open ended", Contest{}, false},
+		{"before the end", Contest{EndsAt: &future}, false},
+		{"after the end", Contest{EndsAt: &past}, true},
+		{"voting ends before the contest", Contest{EndsAt: &future, VotingEndsAt: &past}, true},
+		{"voting ends after the contest", Contest{EndsAt: &past, VotingEndsAt: &future}, false},
+	}
+
+	for _, c := range cases {
+		if closed := c.contest.VotingClosed(now); closed != c.closed {
+			t.Errorf("%s: expected closed %v, got %v", c.name, c.closed, closed)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Public DTOs are the only shapes the unauthenticated endpoints return. They
+// never carry email, last name or any other personal data of the users.
+
+// PublicPlayer is the public identity of a user.
+// swagger:model
+type PublicPlayer struct {
+	ID          uint    `json:"id"`
+	Handle      string  `json:"handle"`
+	DisplayName *string `json:"displayName"`
+	City        *string `json:"city"`
+	Country     *string `json:"country"`
+}
+
+// NewPublicPlayer keeps the public fields of user.
+func NewPublicPlayer(user User) PublicPlayer {
+	handle := DefaultHandle(user.ID)
+	if user.Handle != nil {
+		handle = *user.Handle
+	}
+	return PublicPlayer{
+		ID:          user.ID,
+		Handle:      handle,
+		DisplayName: user.DisplayName,
+		City:        user.City,
+		Country:     user.Country,
+	}
+}
+
+// PublicVideo is a video as listed for voting.
+// swagger:model
+type PublicVideo struct {
+	ID           uint         `json:"id"`
+	Title        *string      `json:"title"`
+	Status       *string      `json:"status"`
+	Votes        int64        `json:"votes"`
+	Views        int64        `json:"views"`
+	ProcessedURL *string      `json:"processedUrl"`
+	ThumbnailURL *string      `json:"thumbnailUrl"`
+	UploadedAt   *time.Time   `json:"createdAt"`
+	ProcessedAt  *time.Time   `json:"processedAt"`
+	ContestID    *uint        `json:"contestId"`
+	UserID       uint         `json:"user_id"`
+	User         PublicPlayer `json:"User"`
+}
+
+// NewPublicVideo keeps the public fields of video, whose User must be loaded
+// and whose URLs must already be signed.
+func NewPublicVideo(video Video) PublicVideo {
+	return PublicVideo{
+		ID:           video.ID,
+		Title:        video.Title,
+		Status:       video.Status,
+		Votes:        video.VoteCount,
+		Views:        video.ViewCount,
+		ProcessedURL: video.ProcessedURL,
+		ThumbnailURL: video.ThumbnailURL,
+		UploadedAt:   video.UploadedAt,
+		ProcessedAt:  video.ProcessedAt,
+		ContestID:    video.ContestID,
+		UserID:       video.UserID,
+		User:         NewPublicPlayer(video.User),
+	}
+}
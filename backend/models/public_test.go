@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Every type returned by an unauthenticated endpoint
+var publicResponses = []interface{}{
+	PublicVideo{},
+	PublicPlayer{},
+	RankingView{},
+	VideoRanking{},
+	RankingSnapshot{},
+	Contest{},
+}
+
+// Fields that must never reach a public response, by JSON name
+var privateFields = []string{"email", "lastname", "last_name", "password", "firstname", "first_name"}
+
+func TestPublicResponsesHaveNoPrivateFields(t *testing.T) {
+	for _, response := range publicResponses {
+		checkFields(t, reflect.TypeOf(response), reflect.TypeOf(response).Name())
+	}
+}
+
+func checkFields(t *testing.T, typ reflect.Type, path string) {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		for _, private := range privateFields {
+			if strings.EqualFold(name, private) {
+				t.Errorf("%s.%s is exposed as %q", path, field.Name, name)
+			}
+		}
+
+		checkFields(t, field.Type, path+"."+field.Name)
+	}
+}
+
+func TestNewPublicVideoDropsPersonalData(t *testing.T) {
+	email := "player@example.com"
+	lastName := "Apellido"
+	title := "Mi video"
+	video := Video{
+		ID:     1,
+		Title:  &title,
+		UserID: 2,
+		User:   User{ID: 2, Email: &email, LastName: &lastName},
+	}
+
+	body, err := json.Marshal(NewPublicVideo(video))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{email, lastName} {
+		if strings.Contains(string(body), value) {
+			t.Errorf("public video contains %q: %s", value, body)
+		}
+	}
+	if !strings.Contains(string(body), `"handle":"jugador2"`) {
+		t.Errorf("expected the default handle, got %s", body)
+	}
+}
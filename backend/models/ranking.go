@@ -1,13 +1,56 @@
 package models
 
+import "gorm.io/gorm"
+
 // swagger:model
 type RankingView struct {
-	UserID int    `gorm:"column:user_id"`
-	Email  string `gorm:"column:email"`
-	City   string `gorm:"column:city"`
-	Votes  int    `gorm:"column:votes"`
+	UserID      int     `gorm:"column:user_id" json:"userId"`
+	Handle      string  `gorm:"column:handle" json:"handle"`
+	DisplayName *string `gorm:"column:display_name" json:"displayName"`
+	City        string  `gorm:"column:city" json:"city"`
+	Votes       int     `gorm:"column:votes" json:"votes"`
+
+	// Posición (empates comparten posición), videos que suman al puntaje
+	// y el video con más votos del jugador
+	Rank           int     `gorm:"column:rank" json:"rank"`
+	Videos         int     `gorm:"column:videos" json:"videos"`
+	BestVideoID    uint    `gorm:"column:best_video_id" json:"bestVideoId"`
+	BestVideoTitle *string `gorm:"column:best_video_title" json:"bestVideoTitle"`
+
+	// Jugadores en el ranking filtrado, para paginar
+	Total int64 `gorm:"column:total" json:"-"`
+}
+
+// MigrateRankings drops the materialized view the rankings were read from.
+// They are now computed from the per-video vote counters.
+func MigrateRankings(db *gorm.DB) error {
+
+	err := db.Exec("DROP MATERIALIZED VIEW IF EXISTS ranking_view").Error
+
+	return err
 }
 
-func (RankingView) TableName() string {
-	return "ranking_view"
+// VideoRanking is a row of the per-video ranking.
+// swagger:model
+type VideoRanking struct {
+	Rank    int     `gorm:"column:rank" json:"rank"`
+	VideoID uint    `gorm:"column:video_id" json:"videoId"`
+	Title   *string `gorm:"column:title" json:"title"`
+	Votes   int64   `gorm:"column:votes" json:"votes"`
+	Views   int64   `gorm:"column:views" json:"views"`
+
+	// Puntaje según la estrategia del ranking; con raw son los votos
+	Score float64 `gorm:"column:score" json:"score"`
+
+	// Videos en el ranking filtrado, para paginar
+	Total int64 `gorm:"column:total" json:"-"`
+
+	ThumbnailKey *string `gorm:"column:thumbnail_key" json:"-"`
+	ThumbnailURL *string `gorm:"-" json:"thumbnailUrl"`
+
+	// Jugador que subió el video
+	UserID      uint    `gorm:"column:user_id" json:"userId"`
+	Handle      string  `gorm:"column:handle" json:"handle"`
+	DisplayName *string `gorm:"column:display_name" json:"displayName"`
+	City        *string `gorm:"column:city" json:"city"`
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snapshot kinds
+const (
+	SnapshotPeriodic = "periodic"
+	// Standings frozen when the contest closed
+	SnapshotFinal = "final"
+)
+
+// Snapshot scopes
+const (
+	SnapshotVideo  = "video"
+	SnapshotPlayer = "player"
+)
+
+// RankingSnapshot is the position of a video or player, within its contest,
+// at the time the snapshot was taken. A nil ContestID is the videos outside
+// any contest.
+// swagger:model
+type RankingSnapshot struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	TakenAt   time.Time `gorm:"index;index:idx_ranking_snapshots_subject,priority:3" json:"takenAt"`
+	Kind      string    `json:"kind"`
+	ContestID *uint     `gorm:"index" json:"contestId"`
+	Scope     string    `gorm:"index:idx_ranking_snapshots_subject,priority:1" json:"scope"`
+	SubjectID uint      `gorm:"index:idx_ranking_snapshots_subject,priority:2" json:"subjectId"`
+	Rank      int       `json:"rank"`
+	Votes     int64     `json:"votes"`
+	// Puntaje con el que se ordenó: el de la estrategia del concurso para
+	// videos y los votos agregados para jugadores
+	Score float64 `gorm:"not null;default:0" json:"score"`
+}
+
+func MigrateRankingSnapshots(db *gorm.DB) error {
+
+	err := db.AutoMigrate(&RankingSnapshot{})
+
+	return err
+}
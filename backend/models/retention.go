@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RetentionAction records what a retention rule did to a video. Rows outlive
+// purged videos, so they are the audit trail of the policy.
+// swagger:model
+type RetentionAction struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	VideoID   uint      `gorm:"index" json:"video_id"`
+	Rule      string    `json:"rule"`
+	Action    string    `json:"action"`
+	ObjectKey *string   `json:"objectKey"`
+	Status    string    `json:"status"`
+	Error     *string   `json:"error"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+func MigrateRetentionActions(db *gorm.DB) error {
+
+	err := db.AutoMigrate(&RetentionAction{})
+
+	return err
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StorageDeletion is a pending or finished removal of stored objects. Rows
+// outlive the video they belonged to, so failed deletions stay on record.
+// swagger:model
+type StorageDeletion struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	VideoID       uint       `gorm:"index" json:"video_id"`
+	ObjectKey     string     `json:"objectKey"`
+	IsPrefix      bool       `json:"isPrefix"`
+	Status        string     `gorm:"index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"lastError"`
+	NextAttemptAt time.Time  `gorm:"index" json:"nextAttemptAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	CompletedAt   *time.Time `json:"completedAt"`
+}
+
+// VideoDeletions lists everything stored for a video: its original, and its
+// processed output, thumbnails and renditions, which share a key prefix.
+func VideoDeletions(video Video) []StorageDeletion {
+	now := time.Now()
+	deletions := []StorageDeletion{}
+
+	if video.OriginalKey != nil && *video.OriginalKey != "" {
+		deletions = append(deletions, StorageDeletion{
+			VideoID:       video.ID,
+			ObjectKey:     *video.OriginalKey,
+			Status:        "pending",
+			NextAttemptAt: now,
+		})
+	}
+
+	if video.ProcessedKey != nil && *video.ProcessedKey != "" && !strings.HasPrefix(*video.ProcessedKey, video.DerivedPrefix()) {
+		deletions = append(deletions, StorageDeletion{
+			VideoID:       video.ID,
+			ObjectKey:     *video.ProcessedKey,
+			Status:        "pending",
+			NextAttemptAt: now,
+		})
+	}
+
+	deletions = append(deletions, StorageDeletion{
+		VideoID:       video.ID,
+		ObjectKey:     video.DerivedPrefix(),
+		IsPrefix:      true,
+		Status:        "pending",
+		NextAttemptAt: now,
+	})
+
+	return deletions
+}
+
+// LockObject takes, until tx ends, the advisory lock of a stored object key.
+// Storing an original under a shared key and deleting that key both hold it,
+// so a deletion never removes an object that was just stored again.
+func LockObject(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
+
+func MigrateStorageDeletions(db *gorm.DB) error {
+
+	err := db.AutoMigrate(&StorageDeletion{})
+
+	return err
+}
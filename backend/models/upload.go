@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// swagger:model
+type Upload struct {
+	ID             string  `gorm:"primaryKey;type:uuid" json:"id"`
+	Protocol       string  `gorm:"default:presigned" json:"protocol"`
+	Title          *string `json:"title"`
+	ObjectKey      string  `json:"-"`
+	ContentType    *string `json:"contentType"`
+	DeclaredSize   int64   `json:"size"`
+	Offset         int64   `gorm:"column:upload_offset" json:"offset"`
+	ChecksumSHA256 *string `json:"checksumSha256"`
+	LowPriority    bool    `json:"lowPriority"`
+
+	// Carga multiparte de S3 que recibe los fragmentos tus y estado del
+	// SHA-256 de los bytes recibidos, para continuarlo en el siguiente fragmento
+	MultipartID *string `json:"-"`
+	HashState   []byte  `json:"-"`
+	Status      string  `gorm:"index" json:"status"`
+
+	// Concurso al que se inscribe el video
+	ContestID *uint `json:"contestId"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Cuándo se empezó a completar la carga (status completing)
+	ClaimedAt *time.Time `json:"-"`
+
+	//Relacion con User
+	UserID uint `gorm:"index" json:"user_id"`
+	User   User `gorm:"foreignKey:UserID" json:"-"`
+
+	//Video creado al completar la carga
+	VideoID *uint `json:"video_id"`
+}
+
+// Bytes of a tus upload not yet sent as a part, stored as their own object:
+// parts other than the last must be at least 5 MiB, so what a request leaves
+// below that starts the part of the next request.
+type UploadChunk struct {
+	UploadID  string `gorm:"primaryKey;type:uuid"`
+	Offset    int64  `gorm:"primaryKey;column:chunk_offset"`
+	Size      int64
+	ObjectKey string
+}
+
+// Part of the multipart upload of a tus upload.
+type UploadPart struct {
+	UploadID   string `gorm:"primaryKey;type:uuid"`
+	PartNumber int32  `gorm:"primaryKey"`
+	Offset     int64  `gorm:"column:part_offset"`
+	Size       int64
+	ETag       string
+}
+
+// UploadEvent is the append-only log of the videos each user uploaded. The
+// daily upload quota counts it, so deleting a video does not give the upload
+// back.
+type UploadEvent struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	UserID    uint `gorm:"index:idx_upload_events_user_created"`
+	VideoID   uint
+	CreatedAt time.Time `gorm:"index:idx_upload_events_user_created"`
+}
+
+func MigrateUploads(db *gorm.DB) error {
+
+	backfillEvents := !db.Migrator().HasTable(&UploadEvent{}) && db.Migrator().HasTable(&Video{})
+
+	err := db.AutoMigrate(&Upload{}, &UploadChunk{}, &UploadPart{}, &UploadEvent{})
+	if err != nil {
+		return err
+	}
+
+	// Only the daily window is counted, so the log starts with its videos
+	if backfillEvents {
+		err = db.Exec(`
+			INSERT INTO upload_events (user_id, video_id, created_at)
+			SELECT user_id, id, uploaded_at
+			FROM videos
+			WHERE uploaded_at >= NOW() - INTERVAL '1 day'
+			`).Error
+	}
+
+	return err
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -15,13 +18,35 @@ type User struct {
 	Country   *string `json:"country"`
 	Type      *string `json:"type"`
 
+	// Identidad pública: los endpoints públicos muestran solo estos datos
+	Handle      *string `gorm:"uniqueIndex" json:"handle"`
+	DisplayName *string `json:"displayName"`
+
+	// Null for accounts created before it was recorded
+	CreatedAt *time.Time `gorm:"autoCreateTime" json:"createdAt"`
+
 	Videos []Video `json:"-"`
 	Votes  []Vote  `json:"-"`
 }
 
+// DefaultHandle is the handle given to users who did not choose one.
+func DefaultHandle(id uint) string {
+	return fmt.Sprintf("jugador%d", id)
+}
+
 func MigrateUsers(db *gorm.DB) error {
 
 	err := db.AutoMigrate(&User{})
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Los usuarios anteriores a los handles reciben uno por defecto y su
+	// nombre como nombre público
+	return db.Exec(`
+		UPDATE users
+		SET handle = 'jugador' || id,
+			display_name = COALESCE(display_name, first_name)
+		WHERE handle IS NULL
+		`).Error
 }
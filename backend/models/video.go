@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,24 +10,129 @@ import (
 // swagger:model
 type Video struct {
 	ID           uint    `gorm:"primaryKey;autoIncrement" json:"id"`
-	ProcessedURL *string `json:"processedUrl"`
-	OriginalURL  *string `json:"originalUrl"`
+	ProcessedKey *string `json:"-"`
+	OriginalKey  *string `json:"-"`
+	ThumbnailKey *string `json:"-"`
 	Title        *string `json:"title"`
 	Status       *string `json:"status"`
+	SizeBytes    *int64  `json:"sizeBytes"`
+
+	// Motivo del estado cuando el video no pudo continuar (ingesta fallida, rechazo)
+	StatusReason *string `json:"statusReason"`
+
+	// SHA-256 (hex) del original, calculado al recibirlo. Único por usuario:
+	// otra carga del mismo contenido devuelve el video existente
+	ChecksumSHA256 *string `gorm:"uniqueIndex:idx_videos_checksum_user,priority:1" json:"checksumSha256"`
+
+	// Video de otro usuario con el mismo contenido; queda marcado para revisión
+	DuplicateOfID *uint   `json:"duplicateOf"`
+	ReviewReason  *string `json:"reviewReason"`
 
 	UploadedAt  *time.Time `json:"createdAt"`
 	ProcessedAt *time.Time `json:"processedAt"`
 
+	// URL de origen de los videos ingeridos e intentos de descarga, para
+	// retomar las ingestas interrumpidas
+	SourceURL      *string `json:"-"`
+	IngestAttempts int     `gorm:"not null;default:0" json:"-"`
+
+	// Cuándo se encoló el procesamiento; nil mientras falte encolarlo
+	EnqueuedAt *time.Time `gorm:"index" json:"-"`
+
+	// Concurso al que se inscribió el video
+	ContestID *uint `gorm:"index" json:"contestId"`
+
+	// Acciones de la política de retención sobre el original
+	OriginalArchivedAt *time.Time `json:"-"`
+	OriginalDeletedAt  *time.Time `json:"-"`
+
+	// Intentos fallidos de archivar el original y cuándo se reintenta
+	ArchiveFailures int        `gorm:"not null;default:0" json:"-"`
+	ArchiveRetryAt  *time.Time `json:"-"`
+
 	//Relacion con User
-	UserID uint `json:"user_id"`
+	UserID uint `gorm:"uniqueIndex:idx_videos_checksum_user,priority:2" json:"user_id"`
 	User   User `gorm:"foreignKey:UserID"`
 
 	Votes []Vote `json:"-"`
+
+	// Votos del video, actualizado en la misma transacción que cada voto
+	VoteCount int64 `gorm:"not null;default:0;index" json:"votes"`
+
+	// Usuarios distintos que reprodujeron el video (video_views), la
+	// exposición del ranking bayesiano
+	ViewCount int64 `gorm:"not null;default:0" json:"views"`
+
+	// URLs firmadas de corta duración, generadas al responder
+	ProcessedURL *string `gorm:"-" json:"processedUrl"`
+	OriginalURL  *string `gorm:"-" json:"originalUrl"`
+	ThumbnailURL *string `gorm:"-" json:"thumbnailUrl"`
+}
+
+// DerivedPrefix is the key prefix shared by the processed output and every
+// other object derived from the original (thumbnails, renditions).
+func (v Video) DerivedPrefix() string {
+	return fmt.Sprintf("processed/%d_", v.ID)
+}
+
+// VideoView records that a user played a video, so each user counts once
+// towards its views.
+type VideoView struct {
+	VideoID   uint      `gorm:"primaryKey" json:"video_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 func MigrateVideos(db *gorm.DB) error {
 
-	err := db.AutoMigrate(&Video{})
+	backfillVotes := !db.Migrator().HasColumn(&Video{}, "vote_count") && db.Migrator().HasTable("votes")
+	backfillEnqueued := db.Migrator().HasTable(&Video{}) && !db.Migrator().HasColumn(&Video{}, "enqueued_at")
+
+	err := db.AutoMigrate(&Video{}, &VideoView{})
+	if err != nil {
+		return err
+	}
+
+	// El contador de votos se calcula una sola vez, al crear la columna
+	if backfillVotes {
+		err = db.Exec(`
+			UPDATE videos v
+			SET vote_count = c.votes
+			FROM (SELECT video_id, COUNT(*) AS votes FROM votes GROUP BY video_id) c
+			WHERE c.video_id = v.id
+			`).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// Los videos anteriores a la columna ya fueron encolados al crearse
+	if backfillEnqueued {
+		err = db.Exec("UPDATE videos SET enqueued_at = uploaded_at WHERE enqueued_at IS NULL").Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// Las filas anteriores guardaban URLs públicas; se conserva solo la llave del objeto
+	if db.Migrator().HasColumn("videos", "original_url") {
+		err = db.Exec(`
+			UPDATE videos
+			SET original_key = regexp_replace(original_url, '^https?://[^/]+/', '')
+			WHERE original_key IS NULL AND original_url IS NOT NULL
+			`).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if db.Migrator().HasColumn("videos", "processed_url") {
+		err = db.Exec(`
+			UPDATE videos
+			SET processed_key = regexp_replace(processed_url, '^https?://[^/]+/', '')
+			WHERE processed_key IS NULL AND processed_url IS NOT NULL
+			`).Error
+	}
 
 	return err
 }
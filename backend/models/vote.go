@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -15,9 +17,25 @@ type Vote struct {
 	Video   Video `gorm:"foreignKey:VideoID	"`
 }
 
+// Vote event actions
+const (
+	VoteCast    = "cast"
+	VoteRetract = "retract"
+)
+
+// VoteEvent records each time a user casts or retracts a vote, which the
+// cooldown between vote changes is measured from.
+type VoteEvent struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint      `gorm:"index:idx_vote_events_user_video" json:"user_id"`
+	VideoID   uint      `gorm:"index:idx_vote_events_user_video" json:"video_id"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 func MigrateVotes(db *gorm.DB) error {
 
-	err := db.AutoMigrate(&Vote{})
+	err := db.AutoMigrate(&Vote{}, &VoteEvent{})
 
 	return err
 }
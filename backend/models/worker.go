@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// swagger:model
+type WorkerHeartbeat struct {
+	WorkerID   string    `gorm:"primaryKey" json:"workerId"`
+	InFlight   int64     `json:"inFlight"`
+	Processed  int64     `json:"processed"`
+	Failed     int64     `json:"failed"`
+	StartedAt  time.Time `json:"startedAt"`
+	LastSeenAt time.Time `gorm:"index" json:"lastSeenAt"`
+}
+
+func MigrateWorkerHeartbeats(db *gorm.DB) error {
+
+	err := db.AutoMigrate(&WorkerHeartbeat{})
+
+	return err
+}
@@ -0,0 +1,123 @@
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Window of the daily upload limit; it is rolling, not a calendar day.
+const Day = 24 * time.Hour
+
+// Limits are the per-user upload quotas. A zero limit is unlimited.
+type Limits struct {
+	// Videos a user can submit to one contest
+	VideosPerContest int64 `json:"videosPerContest"`
+	// Bytes of originals a user can keep stored
+	TotalBytes int64 `json:"totalBytes"`
+	// Uploads a user can start in any 24 hour window
+	UploadsPerDay int64 `json:"uploadsPerDay"`
+}
+
+// LoadLimits reads the quotas from the environment.
+func LoadLimits() Limits {
+	return Limits{
+		VideosPerContest: envInt("QUOTA_VIDEOS_PER_CONTEST", 0),
+		TotalBytes:       envInt("QUOTA_TOTAL_BYTES", 0),
+		UploadsPerDay:    envInt("QUOTA_UPLOADS_PER_DAY", 0),
+	}
+}
+
+// Usage is what a user has consumed of each quota.
+type Usage struct {
+	VideosInContest int64 `json:"videosInContest"`
+	TotalBytes      int64 `json:"totalBytes"`
+	UploadsToday    int64 `json:"uploadsToday"`
+	// Start of the oldest upload in the daily window, which frees a slot
+	// when it leaves the window
+	OldestUploadToday *time.Time `json:"-"`
+}
+
+// Remaining is the allowance left on each quota; nil means unlimited.
+type Remaining struct {
+	VideosInContest *int64 `json:"videosInContest"`
+	TotalBytes      *int64 `json:"totalBytes"`
+	UploadsToday    *int64 `json:"uploadsToday"`
+}
+
+// Exceeded is the error returned when an upload would go over a quota.
+type Exceeded struct {
+	Limit   string
+	Message string
+	// 429 for the daily rate, 403 for the hard allowances
+	Status int
+	// Only set for the daily rate
+	RetryAfter time.Duration
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("quota %s exceeded: %s", e.Limit, e.Message)
+}
+
+// Check returns the first quota that one more video of size bytes would
+// exceed, or nil. A size of zero skips the byte quota, for uploads whose size
+// is not known yet.
+func (l Limits) Check(usage Usage, size int64, now time.Time) *Exceeded {
+	if l.UploadsPerDay > 0 && usage.UploadsToday >= l.UploadsPerDay {
+		retryAfter := Day
+		if usage.OldestUploadToday != nil {
+			retryAfter = usage.OldestUploadToday.Add(Day).Sub(now)
+		}
+		return &Exceeded{
+			Limit:      "uploads_per_day",
+			Message:    fmt.Sprintf("Daily limit of %d uploads reached", l.UploadsPerDay),
+			Status:     http.StatusTooManyRequests,
+			RetryAfter: max(retryAfter, time.Second),
+		}
+	}
+
+	if l.VideosPerContest > 0 && usage.VideosInContest >= l.VideosPerContest {
+		return &Exceeded{
+			Limit:   "videos_per_contest",
+			Message: fmt.Sprintf("Limit of %d videos per contest reached", l.VideosPerContest),
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	if l.TotalBytes > 0 && size > 0 && usage.TotalBytes+size > l.TotalBytes {
+		return &Exceeded{
+			Limit:   "total_bytes",
+			Message: fmt.Sprintf("Storage quota of %d bytes exceeded", l.TotalBytes),
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
+// Remaining returns the allowance left on each quota.
+func (l Limits) Remaining(usage Usage) Remaining {
+	left := func(limit, used int64) *int64 {
+		if limit <= 0 {
+			return nil
+		}
+		value := max(limit-used, 0)
+		return &value
+	}
+
+	return Remaining{
+		VideosInContest: left(l.VideosPerContest, usage.VideosInContest),
+		TotalBytes:      left(l.TotalBytes, usage.TotalBytes),
+		UploadsToday:    left(l.UploadsPerDay, usage.UploadsToday),
+	}
+}
+
+func envInt(key string, def int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,61 @@
+package quota
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimits_Check(t *testing.T) {
+	now := time.Now()
+	oldest := now.Add(-23 * time.Hour)
+	limits := Limits{VideosPerContest: 2, TotalBytes: 1000, UploadsPerDay: 5}
+
+	cases := []struct {
+		name   string
+		usage  Usage
+		size   int64
+		limit  string
+		status int
+	}{
+		{"within quotas", Usage{VideosInContest: 1, TotalBytes: 500, UploadsToday: 4}, 500, "", 0},
+		{"daily rate", Usage{UploadsToday: 5, OldestUploadToday: &oldest}, 10, "uploads_per_day", http.StatusTooManyRequests},
+		{"contest limit", Usage{VideosInContest: 2}, 10, "videos_per_contest", http.StatusForbidden},
+		{"byte quota", Usage{TotalBytes: 900}, 101, "total_bytes", http.StatusForbidden},
+		{"unknown size skips bytes", Usage{TotalBytes: 1000}, 0, "", 0},
+	}
+
+	for _, c := range cases {
+		exceeded := limits.Check(c.usage, c.size, now)
+		switch {
+		case c.limit == "" && exceeded != nil:
+			t.Errorf("%s: expected no violation, got %v", c.name, exceeded)
+		case c.limit != "" && (exceeded == nil || exceeded.Limit != c.limit || exceeded.Status != c.status):
+			t.Errorf("%s: expected %s (%d), got %+v", c.name, c.limit, c.status, exceeded)
+		}
+	}
+}
+
+func TestLimits_CheckRetryAfter(t *testing.T) {
+	now := time.Now()
+	oldest := now.Add(-23 * time.Hour)
+
+	exceeded := Limits{UploadsPerDay: 1}.Check(Usage{UploadsToday: 1, OldestUploadToday: &oldest}, 0, now)
+	if exceeded == nil || exceeded.RetryAfter != time.Hour {
+		t.Fatalf("expected retry after 1h, got %+v", exceeded)
+	}
+}
+
+func TestLimits_Remaining(t *testing.T) {
+	remaining := Limits{VideosPerContest: 3, UploadsPerDay: 2}.Remaining(Usage{VideosInContest: 1, UploadsToday: 4, TotalBytes: 99})
+
+	if remaining.VideosInContest == nil || *remaining.VideosInContest != 2 {
+		t.Errorf("expected 2 videos left, got %v", remaining.VideosInContest)
+	}
+	if remaining.UploadsToday == nil || *remaining.UploadsToday != 0 {
+		t.Errorf("expected 0 uploads left, got %v", remaining.UploadsToday)
+	}
+	if remaining.TotalBytes != nil {
+		t.Errorf("expected unlimited bytes, got %d", *remaining.TotalBytes)
+	}
+}
@@ -0,0 +1,105 @@
+package ranking
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache keeps computed rankings for a short window, so the requests for the
+// same ranking within it share one query, as Stream does with a burst of
+// votes. Requests that miss at the same time wait for a single load. A nil
+// Cache loads on every call.
+type Cache[V any] struct {
+	TTL time.Duration
+	// Rankings kept at most; the expired ones are dropped first when full
+	Size int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry[V]
+	now     func() time.Time
+}
+
+type cacheEntry[V any] struct {
+	// Closed once the load finishes
+	ready     chan struct{}
+	value     V
+	err       error
+	expiresAt time.Time
+}
+
+func NewCache[V any](ttl time.Duration, size int) *Cache[V] {
+	return &Cache[V]{
+		TTL:     ttl,
+		Size:    size,
+		entries: map[string]*cacheEntry[V]{},
+		now:     time.Now,
+	}
+}
+
+// Get returns the ranking stored under key, loading it when it is missing or
+// expired. Failed loads are not kept.
+func (c *Cache[V]) Get(key string, load func() (V, error)) (V, error) {
+	if c == nil || c.TTL <= 0 {
+		return load()
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !c.expired(entry) {
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.value, entry.err
+	}
+
+	c.evict()
+	entry = &cacheEntry[V]{ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	entry.value, entry.err = load()
+
+	c.mu.Lock()
+	entry.expiresAt = c.now().Add(c.TTL)
+	if entry.err != nil && c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+	close(entry.ready)
+	c.mu.Unlock()
+
+	return entry.value, entry.err
+}
+
+// expired reports whether a loaded entry is past its window. Entries still
+// loading are never expired. c.mu must be held.
+func (c *Cache[V]) expired(entry *cacheEntry[V]) bool {
+	return isReady(entry.ready) && !c.now().Before(entry.expiresAt)
+}
+
+// evict makes room for one more entry. c.mu must be held.
+func (c *Cache[V]) evict() {
+	if c.Size <= 0 || len(c.entries) < c.Size {
+		return
+	}
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			delete(c.entries, key)
+		}
+	}
+	// Still full of fresh rankings: start over rather than grow
+	if len(c.entries) >= c.Size {
+		for key, entry := range c.entries {
+			if isReady(entry.ready) {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+func isReady(ready chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+package ranking
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_ReusesWithinWindow(t *testing.T) {
+	now := time.Now()
+	cache := NewCache[int](time.Second, 10)
+	cache.now = func() time.Time { return now }
+
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for _, step := range []struct {
+		advance time.Duration
+		value   int
+	}{
+		{0, 1},
+		{500 * time.Millisecond, 1},
+		{time.Second, 2},
+	} {
+		now = now.Add(step.advance)
+		value, err := cache.Get("sum", load)
+		if err != nil || value != step.value {
+			t.Fatalf("after %s: expected %d, got %d (%v)", step.advance, step.value, value, err)
+		}
+	}
+
+	if value, _ := cache.Get("max", load); value != 3 {
+		t.Errorf("expected another key to load its own ranking, got %d", value)
+	}
+}
+
+func TestCache_DoesNotKeepErrors(t *testing.T) {
+	cache := NewCache[int](time.Minute, 10)
+
+	if _, err := cache.Get("sum", func() (int, error) { return 0, errors.New("db down") }); err == nil {
+		t.Fatal("expected the load error")
+	}
+	if value, err := cache.Get("sum", func() (int, error) { return 7, nil }); err != nil || value != 7 {
+		t.Errorf("expected a reload after the error, got %d (%v)", value, err)
+	}
+}
+
+func TestCache_SharesConcurrentLoads(t *testing.T) {
+	cache := NewCache[int](time.Minute, 10)
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (int, error) {
+		loads.Add(1)
+		<-release
+		return 1, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cache.Get("sum", load)
+	}()
+	// Let the first caller register its load before the others arrive
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, _ := cache.Get("sum", load); value != 1 {
+				t.Errorf("expected the shared ranking, got %d", value)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("expected one load, got %d", n)
+	}
+}
+
+func TestCache_BoundsEntries(t *testing.T) {
+	cache := NewCache[int](time.Minute, 2)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		cache.Get(key, func() (int, error) { return 0, nil })
+	}
+	if n := len(cache.entries); n > 2 {
+		t.Errorf("expected at most 2 rankings kept, got %d", n)
+	}
+}
+
+func TestCache_NilLoadsEveryTime(t *testing.T) {
+	var cache *Cache[int]
+	loads := 0
+	for i := 0; i < 2; i++ {
+		cache.Get("sum", func() (int, error) { loads++; return loads, nil })
+	}
+	if loads != 2 {
+		t.Errorf("expected 2 loads, got %d", loads)
+	}
+}
@@ -0,0 +1,252 @@
+package ranking
+
+import (
+	"back-end-todolist/models"
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// snapshotLockKey identifies the advisory lock that keeps snapshots on a
+// single instance at a time.
+const snapshotLockKey int64 = 0x616e625f736e // "anb_sn"
+
+// Snapshotter stores the video and player rankings of every contest in
+// ranking_snapshots: periodically, and once more, as the final standings,
+// when the voting of each contest closes. Old periodic snapshots are thinned
+// to one per day.
+type Snapshotter struct {
+	DB *gorm.DB
+	// Time between periodic snapshots; 0 takes only final standings
+	Interval time.Duration
+	// Aggregation of the player snapshots and strategies of the video ones
+	Config Config
+}
+
+func NewSnapshotter(db *gorm.DB, interval time.Duration, config Config) *Snapshotter {
+	return &Snapshotter{DB: db, Interval: interval, Config: config}
+}
+
+// Run checks every tick whether a snapshot is due until ctx is cancelled.
+// The tick bounds how late after its deadline a contest is frozen.
+func (s *Snapshotter) Run(ctx context.Context, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		if taken, err := s.RunOnce(ctx); err != nil {
+			log.Printf("Error taking ranking snapshots: %v", err)
+		} else if taken > 0 {
+			log.Printf("Ranking snapshots taken: %d", taken)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce takes the snapshots that are due and returns how many it took. If
+// another instance holds the lock it does nothing.
+func (s *Snapshotter) RunOnce(ctx context.Context) (int, error) {
+	taken := 0
+	now := time.Now()
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked := false
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", snapshotLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		if s.Interval > 0 {
+			var last *time.Time
+			if err := tx.Model(&models.RankingSnapshot{}).
+				Select("MAX(taken_at)").
+				Where("kind = ?", models.SnapshotPeriodic).
+				Scan(&last).Error; err != nil {
+				return err
+			}
+			if s.periodicDue(last, now) {
+				if err := s.take(tx, now, models.SnapshotPeriodic, nil); err != nil {
+					return err
+				}
+				taken++
+
+				if s.Config.SnapshotDownsampleAfter > 0 {
+					if err := downsample(tx, now.Add(-s.Config.SnapshotDownsampleAfter)).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		contests := []models.Contest{}
+		if err := dueContests(tx, now).Find(&contests).Error; err != nil {
+			return err
+		}
+		for _, contest := range contests {
+			if err := s.take(tx, now, models.SnapshotFinal, &contest.ID); err != nil {
+				return err
+			}
+			if err := tx.Model(&contest).Update("finalized_at", now).Error; err != nil {
+				return err
+			}
+			taken++
+		}
+
+		return nil
+	})
+
+	return taken, err
+}
+
+// periodicDue reports whether a periodic snapshot is due given when the last
+// one was taken.
+func (s *Snapshotter) periodicDue(last *time.Time, now time.Time) bool {
+	return s.Interval > 0 && (last == nil || now.Sub(*last) >= s.Interval)
+}
+
+// dueContests selects the contests whose voting closed and whose final
+// standings were not taken yet.
+func dueContests(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("COALESCE(voting_ends_at, ends_at) <= ? AND finalized_at IS NULL", now)
+}
+
+// downsample deletes the periodic snapshots taken before cutoff except the
+// first of each day.
+func downsample(tx *gorm.DB, cutoff time.Time) *gorm.DB {
+	return tx.Exec(`
+		DELETE FROM ranking_snapshots
+		WHERE kind = ? AND taken_at < ? AND taken_at NOT IN (
+			SELECT MIN(taken_at)
+			FROM ranking_snapshots
+			WHERE kind = ? AND taken_at < ?
+			GROUP BY date_trunc('day', taken_at)
+		)`, models.SnapshotPeriodic, cutoff, models.SnapshotPeriodic, cutoff)
+}
+
+// take stores the video and player rankings, ranked within each contest.
+// Videos are ranked with the strategy of their contest. With contestID only
+// that contest is stored.
+func (s *Snapshotter) take(tx *gorm.DB, now time.Time, kind string, contestID *uint) error {
+	filter := "v.status = 'processed'"
+	args := []interface{}{}
+	if contestID != nil {
+		filter += " AND v.contest_id = ?"
+		args = append(args, *contestID)
+	}
+
+	contests := []models.Contest{}
+	query := tx.Select("id", "ranking_strategy").Where("ranking_strategy IS NOT NULL")
+	if contestID != nil {
+		query = query.Where("id = ?", *contestID)
+	}
+	if err := query.Find(&contests).Error; err != nil {
+		return err
+	}
+
+	for _, group := range s.strategyGroups(contests, filter, args) {
+		if err := s.videoSnapshot(tx, now, kind, group).Error; err != nil {
+			return err
+		}
+	}
+
+	counted := s.Config.VideosCounted(s.Config.PlayerMode, 0)
+	playerArgs := append(args, counted, counted, now, kind, models.SnapshotPlayer)
+	return tx.Exec(`
+		WITH numbered AS (
+			SELECT
+				v.contest_id,
+				v.user_id,
+				v.vote_count,
+				ROW_NUMBER() OVER (PARTITION BY v.contest_id, v.user_id ORDER BY v.vote_count DESC, v.id) AS position
+			FROM videos v
+			WHERE `+filter+`
+		), scores AS (
+			SELECT contest_id, user_id, SUM(vote_count) AS votes
+			FROM numbered
+			WHERE ? = 0 OR position <= ?
+			GROUP BY contest_id, user_id
+		)
+		INSERT INTO ranking_snapshots (taken_at, kind, contest_id, scope, subject_id, rank, votes, score)
+		SELECT
+			?, ?, contest_id, ?, user_id,
+			RANK() OVER (PARTITION BY contest_id ORDER BY votes DESC),
+			votes,
+			votes
+		FROM scores
+		`, playerArgs...).Error
+}
+
+// strategyGroup is the videos a snapshot ranks with one strategy.
+type strategyGroup struct {
+	strategy Strategy
+	filter   string
+	args     []interface{}
+}
+
+// strategyGroups splits the videos selected by filter by the strategy of
+// their contest. Every contest falls in a single group, so ranking each
+// group within its contests ranks every contest. contests are the contests
+// that picked a strategy.
+func (s *Snapshotter) strategyGroups(contests []models.Contest, filter string, args []interface{}) []strategyGroup {
+	picked := map[Strategy][]uint{}
+	others := []uint{}
+	for _, contest := range contests {
+		strategy := s.Config.ContestStrategy(contest.RankingStrategy)
+		if strategy == s.Config.Strategy {
+			continue
+		}
+		picked[strategy] = append(picked[strategy], contest.ID)
+		others = append(others, contest.ID)
+	}
+
+	// Videos outside a contest and contests without their own strategy
+	// rank with the configured one
+	group := strategyGroup{strategy: s.Config.Strategy, filter: filter, args: args}
+	if len(others) > 0 {
+		group.filter += " AND (v.contest_id IS NULL OR v.contest_id NOT IN ?)"
+		group.args = append(append([]interface{}{}, args...), others)
+	}
+	groups := []strategyGroup{group}
+
+	for _, strategy := range []Strategy{StrategyRaw, StrategyTrending, StrategyBayesian} {
+		if ids := picked[strategy]; len(ids) > 0 {
+			groups = append(groups, strategyGroup{
+				strategy: strategy,
+				filter:   filter + " AND v.contest_id IN ?",
+				args:     append(append([]interface{}{}, args...), ids),
+			})
+		}
+	}
+	return groups
+}
+
+// videoSnapshot stores the video rankings of the group, ranked within each
+// contest by the group's strategy.
+func (s *Snapshotter) videoSnapshot(tx *gorm.DB, now time.Time, kind string, group strategyGroup) *gorm.DB {
+	score, scoreArgs := s.Config.Score(group.strategy)
+	args := append([]interface{}{now, kind, models.SnapshotVideo}, scoreArgs...)
+	return tx.Exec(`
+		INSERT INTO ranking_snapshots (taken_at, kind, contest_id, scope, subject_id, rank, votes, score)
+		SELECT
+			?, ?, s.contest_id, ?, s.id,
+			RANK() OVER (PARTITION BY s.contest_id ORDER BY s.score DESC),
+			s.vote_count,
+			s.score
+		FROM (
+			SELECT v.id, v.contest_id, v.vote_count, `+score+` AS score
+			FROM videos v
+			WHERE `+group.filter+`
+		) s
+		`, append(args, group.args...)...)
+}
@@ -0,0 +1,69 @@
+package ranking
+
+import (
+	"back-end-todolist/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotter_PeriodicDue(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-10*time.Minute), now.Add(-2*time.Hour)
+
+	cases := []struct {
+		name     string
+		interval time.Duration
+		last     *time.Time
+		due      bool
+	}{
+		{"first snapshot", time.Hour, nil, true},
+		{"within the interval", time.Hour, &recent, false},
+		{"interval elapsed", time.Hour, &old, true},
+		{"periodic disabled", 0, nil, false},
+	}
+
+	for _, c := range cases {
+		s := NewSnapshotter(nil, c.interval, Config{})
+		if due := s.periodicDue(c.last, now); due != c.due {
+			t.Errorf("%s: expected due %v, got %v", c.name, c.due, due)
+		}
+	}
+}
+
+func TestSnapshotter_StrategyGroups(t *testing.T) {
+	trending, bayesian, raw, unknown := "trending", "bayesian", "raw", "wilson"
+	s := NewSnapshotter(nil, time.Hour, Config{Strategy: StrategyRaw})
+
+	groups := s.strategyGroups([]models.Contest{
+		{ID: 1, RankingStrategy: &trending},
+		{ID: 2, RankingStrategy: &bayesian},
+		{ID: 3, RankingStrategy: &raw},
+		{ID: 4, RankingStrategy: &unknown},
+		{ID: 5, RankingStrategy: &trending},
+	}, "v.status = 'processed'", []interface{}{})
+
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %+v", groups)
+	}
+
+	// Contests with the configured strategy, or an unknown one, stay with
+	// the videos outside any contest
+	if def := groups[0]; def.strategy != StrategyRaw ||
+		!strings.Contains(def.filter, "v.contest_id IS NULL OR v.contest_id NOT IN ?") ||
+		len(def.args) != 1 || len(def.args[0].([]uint)) != 3 {
+		t.Errorf("unexpected default group %+v", def)
+	}
+	if g := groups[1]; g.strategy != StrategyTrending || len(g.args) != 1 ||
+		len(g.args[0].([]uint)) != 2 || g.args[0].([]uint)[1] != 5 {
+		t.Errorf("unexpected trending group %+v", g)
+	}
+	if g := groups[2]; g.strategy != StrategyBayesian || g.args[0].([]uint)[0] != 2 {
+		t.Errorf("unexpected bayesian group %+v", g)
+	}
+
+	// Without contests picking another strategy everything ranks together
+	if groups := s.strategyGroups(nil, "v.status = 'processed'", nil); len(groups) != 1 || groups[0].filter != "v.status = 'processed'" {
+		t.Errorf("expected a single group, got %+v", groups)
+	}
+}
@@ -0,0 +1,143 @@
+package ranking
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mode is how the votes of a player's videos add up to the player's score.
+type Mode string
+
+const (
+	// Votes of every video
+	ModeSum Mode = "sum"
+	// Votes of the player's best video
+	ModeMax Mode = "max"
+	// Votes of the player's N best videos
+	ModeBestN Mode = "best"
+)
+
+// ParseMode validates a mode name. Empty returns def.
+func ParseMode(name string, def Mode) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return def, nil
+	case ModeSum, ModeMax, ModeBestN:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown ranking mode %q", name)
+}
+
+// Config is the default aggregation of the player ranking.
+type Config struct {
+	PlayerMode Mode `json:"playerMode"`
+	// Videos counted per player in ModeBestN
+	BestN int `json:"bestN"`
+
+	// How often vote counters are checked against the votes; 0 disables it
+	ReconcileInterval time.Duration `json:"-"`
+
+	// Live updates: votes arriving within StreamDebounce are sent together,
+	// for the top StreamSize videos
+	StreamDebounce time.Duration `json:"-"`
+	StreamSize     int           `json:"-"`
+
+	// Time between periodic ranking snapshots; 0 keeps only final standings
+	SnapshotInterval time.Duration `json:"-"`
+	// Periodic snapshots older than this are thinned to the first of each
+	// day; 0 keeps them all. Final standings are always kept
+	SnapshotDownsampleAfter time.Duration `json:"-"`
+
+	// Default order of the video ranking, unless the contest or the request
+	// picks another one
+	Strategy Strategy `json:"strategy"`
+	// Exponent of the age in StrategyTrending; higher forgets votes faster
+	TrendingGravity float64 `json:"trendingGravity"`
+	// Views at the site-wide vote rate every video starts with in
+	// StrategyBayesian
+	BayesianPriorViews float64 `json:"bayesianPriorViews"`
+}
+
+// LoadConfig reads the configuration from the environment.
+func LoadConfig() Config {
+	mode, err := ParseMode(os.Getenv("RANKING_PLAYER_MODE"), ModeSum)
+	if err != nil {
+		mode = ModeSum
+	}
+
+	bestN, err := strconv.Atoi(os.Getenv("RANKING_BEST_N"))
+	if err != nil || bestN <= 0 {
+		bestN = 3
+	}
+
+	reconcile, err := time.ParseDuration(os.Getenv("RANKING_RECONCILE_INTERVAL"))
+	if err != nil || reconcile < 0 {
+		reconcile = 15 * time.Minute
+	}
+
+	debounce, err := time.ParseDuration(os.Getenv("RANKING_STREAM_DEBOUNCE"))
+	if err != nil || debounce <= 0 {
+		debounce = time.Second
+	}
+
+	streamSize, err := strconv.Atoi(os.Getenv("RANKING_STREAM_SIZE"))
+	if err != nil || streamSize <= 0 {
+		streamSize = 100
+	}
+
+	snapshots, err := time.ParseDuration(os.Getenv("RANKING_SNAPSHOT_INTERVAL"))
+	if err != nil || snapshots < 0 {
+		snapshots = time.Hour
+	}
+
+	downsample, err := time.ParseDuration(os.Getenv("RANKING_SNAPSHOT_DOWNSAMPLE_AFTER"))
+	if err != nil || downsample < 0 {
+		downsample = 7 * 24 * time.Hour
+	}
+
+	strategy, err := ParseStrategy(os.Getenv("RANKING_STRATEGY"), StrategyRaw)
+	if err != nil {
+		strategy = StrategyRaw
+	}
+
+	gravity, err := strconv.ParseFloat(os.Getenv("RANKING_TRENDING_GRAVITY"), 64)
+	if err != nil || gravity <= 0 {
+		gravity = 1.8
+	}
+
+	priorViews, err := strconv.ParseFloat(os.Getenv("RANKING_BAYESIAN_PRIOR_VIEWS"), 64)
+	if err != nil || priorViews <= 0 {
+		priorViews = 50
+	}
+
+	return Config{
+		PlayerMode:              mode,
+		BestN:                   bestN,
+		ReconcileInterval:       reconcile,
+		StreamDebounce:          debounce,
+		StreamSize:              streamSize,
+		SnapshotInterval:        snapshots,
+		SnapshotDownsampleAfter: downsample,
+		Strategy:                strategy,
+		TrendingGravity:         gravity,
+		BayesianPriorViews:      priorViews,
+	}
+}
+
+// VideosCounted returns how many of a player's videos, best first, count
+// towards the score in mode; 0 counts them all.
+func (c Config) VideosCounted(mode Mode, n int) int {
+	switch mode {
+	case ModeMax:
+		return 1
+	case ModeBestN:
+		if n > 0 {
+			return n
+		}
+		return c.BestN
+	}
+	return 0
+}
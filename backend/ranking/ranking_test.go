@@ -0,0 +1,200 @@
+package ranking
+
+import (
+	"back-end-todolist/models"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMode(t *testing.T) {
+	cases := []struct {
+		name string
+		want Mode
+		err  bool
+	}{
+		{"", ModeMax, false},
+		{"sum", ModeSum, false},
+		{" MAX ", ModeMax, false},
+		{"best", ModeBestN, false},
+		{"median", "", true},
+	}
+
+	for _, c := range cases {
+		mode, err := ParseMode(c.name, ModeMax)
+		if (err != nil) != c.err || mode != c.want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", c.name, mode, err, c.want)
+		}
+	}
+}
+
+func TestConfig_VideosCounted(t *testing.T) {
+	config := Config{PlayerMode: ModeSum, BestN: 3}
+
+	cases := []struct {
+		mode Mode
+		n    int
+		want int
+	}{
+		{ModeSum, 5, 0},
+		{ModeMax, 5, 1},
+		{ModeBestN, 0, 3},
+		{ModeBestN, 2, 2},
+	}
+
+	for _, c := range cases {
+		if got := config.VideosCounted(c.mode, c.n); got != c.want {
+			t.Errorf("VideosCounted(%s, %d) = %d, want %d", c.mode, c.n, got, c.want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("RANKING_PLAYER_MODE", "unknown")
+	t.Setenv("RANKING_BEST_N", "-1")
+	t.Setenv("RANKING_RECONCILE_INTERVAL", "")
+	t.Setenv("RANKING_STRATEGY", "wilson")
+	t.Setenv("RANKING_TRENDING_GRAVITY", "0")
+	t.Setenv("RANKING_SNAPSHOT_DOWNSAMPLE_AFTER", "-1h")
+
+	if config := LoadConfig(); config.PlayerMode != ModeSum || config.BestN != 3 || config.ReconcileInterval != 15*time.Minute ||
+		config.SnapshotDownsampleAfter != 7*24*time.Hour || config.Strategy != StrategyRaw || config.TrendingGravity != 1.8 || config.BayesianPriorViews != 50 {
+		t.Errorf("expected defaults, got %+v", config)
+	}
+
+	t.Setenv("RANKING_PLAYER_MODE", "best")
+	t.Setenv("RANKING_BEST_N", "5")
+	t.Setenv("RANKING_RECONCILE_INTERVAL", "0")
+	t.Setenv("RANKING_STRATEGY", "bayesian")
+	t.Setenv("RANKING_BAYESIAN_PRIOR_VIEWS", "200")
+	t.Setenv("RANKING_SNAPSHOT_DOWNSAMPLE_AFTER", "0")
+
+	if config := LoadConfig(); config.PlayerMode != ModeBestN || config.BestN != 5 || config.ReconcileInterval != 0 ||
+		config.SnapshotDownsampleAfter != 0 || config.Strategy != StrategyBayesian || config.BayesianPriorViews != 200 {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	cases := []struct {
+		name string
+		want Strategy
+		err  bool
+	}{
+		{"", StrategyTrending, false},
+		{"raw", StrategyRaw, false},
+		{" Trending ", StrategyTrending, false},
+		{"bayesian", StrategyBayesian, false},
+		{"wilson", "", true},
+	}
+
+	for _, c := range cases {
+		strategy, err := ParseStrategy(c.name, StrategyTrending)
+		if (err != nil) != c.err || strategy != c.want {
+			t.Errorf("ParseStrategy(%q) = %q, %v; want %q", c.name, strategy, err, c.want)
+		}
+	}
+}
+
+func TestConfig_Score(t *testing.T) {
+	config := Config{TrendingGravity: 1.5, BayesianPriorViews: 20}
+
+	cases := []struct {
+		strategy Strategy
+		args     int
+		param    float64
+	}{
+		{StrategyRaw, 0, 0},
+		{StrategyTrending, 1, 1.5},
+		{StrategyBayesian, 2, 20},
+	}
+
+	for _, c := range cases {
+		expr, args := config.Score(c.strategy)
+		if expr == "" || len(args) != c.args || strings.Count(expr, "?") != c.args {
+			t.Errorf("Score(%s) = %q with %v; want %d arguments", c.strategy, expr, args, c.args)
+			continue
+		}
+		for _, arg := range args {
+			if arg != c.param {
+				t.Errorf("Score(%s) argument %v, want %v", c.strategy, arg, c.param)
+			}
+		}
+	}
+}
+
+// trendingScore and bayesianScore mirror the SQL of Config.Score.
+func trendingScore(votes int64, age time.Duration, gravity float64) float64 {
+	return float64(votes) / math.Pow(age.Hours()+2, gravity)
+}
+
+func bayesianScore(votes, views int64, rate, priorViews float64) float64 {
+	if views < votes {
+		views = votes
+	}
+	return (float64(votes) + priorViews*rate) / (float64(views) + priorViews)
+}
+
+func TestConfig_ScoreOrdering(t *testing.T) {
+	config := Config{TrendingGravity: 1.8, BayesianPriorViews: 20}
+
+	// A day-old video with 40 votes against a two-hour-old one with 10
+	old := trendingScore(40, 24*time.Hour, config.TrendingGravity)
+	recent := trendingScore(10, 2*time.Hour, config.TrendingGravity)
+	if recent <= old {
+		t.Errorf("trending: expected the recent video to overtake the older one, got %.4f <= %.4f", recent, old)
+	}
+	if later := trendingScore(10, 48*time.Hour, config.TrendingGravity); later >= old {
+		t.Errorf("trending: expected the older video to lead once both aged, got %.4f >= %.4f", later, old)
+	}
+
+	// Videos site-wide get one vote every ten views. Three votes out of
+	// three views is a better rate than 40 out of 100, but too few views
+	// to trust it
+	rate := 0.1
+	few := bayesianScore(3, 3, rate, config.BayesianPriorViews)
+	many := bayesianScore(40, 100, rate, config.BayesianPriorViews)
+	if few >= many {
+		t.Errorf("bayesian: expected the video with few views to rank below, got %.4f >= %.4f", few, many)
+	}
+	if few <= rate || few >= 1 {
+		t.Errorf("bayesian: expected %.4f between the site-wide rate %.2f and its own rate 1", few, rate)
+	}
+	if unseen := bayesianScore(0, 0, rate, config.BayesianPriorViews); unseen != rate {
+		t.Errorf("bayesian: expected a video without views to score the site-wide rate, got %.4f", unseen)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := []models.VideoRanking{
+		{Rank: 1, VideoID: 10, Votes: 5},
+		{Rank: 2, VideoID: 20, Votes: 4},
+		{Rank: 3, VideoID: 30, Votes: 1},
+	}
+	current := []models.VideoRanking{
+		{Rank: 1, VideoID: 20, Votes: 6},
+		{Rank: 2, VideoID: 10, Votes: 5},
+		{Rank: 3, VideoID: 40, Votes: 2},
+	}
+
+	update := Diff(previous, current)
+
+	if len(update.Changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", update.Changes)
+	}
+	moved := update.Changes[0]
+	if moved.VideoID != 20 || moved.PreviousRank == nil || *moved.PreviousRank != 2 || *moved.PreviousVotes != 4 {
+		t.Errorf("unexpected change for the leader %+v", moved)
+	}
+	if entered := update.Changes[2]; entered.VideoID != 40 || entered.PreviousRank != nil {
+		t.Errorf("expected video 40 to enter without a previous rank, got %+v", entered)
+	}
+	if len(update.Removed) != 1 || update.Removed[0] != 30 {
+		t.Errorf("expected video 30 to leave, got %v", update.Removed)
+	}
+
+	if unchanged := Diff(current, current); len(unchanged.Changes) != 0 || len(unchanged.Removed) != 0 {
+		t.Errorf("expected no changes, got %+v", unchanged)
+	}
+}
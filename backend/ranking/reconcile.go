@@ -0,0 +1,80 @@
+package ranking
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// reconcileLockKey identifies the advisory lock that keeps reconciliation on
+// a single instance at a time.
+const reconcileLockKey int64 = 0x616e625f726b // "anb_rk"
+
+// Reconciler recomputes the per-video vote counters from the votes table.
+// The counters are maintained in the same transaction as every vote, so
+// reconciliation only repairs drift from manual edits or bugs.
+type Reconciler struct {
+	DB *gorm.DB
+}
+
+func NewReconciler(db *gorm.DB) *Reconciler {
+	return &Reconciler{DB: db}
+}
+
+// Run reconciles every interval until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if fixed, err := r.RunOnce(ctx); err != nil {
+			log.Printf("Error reconciling vote counters: %v", err)
+		} else if fixed > 0 {
+			log.Printf("Vote counters reconciled: %d videos corrected", fixed)
+		}
+	}
+}
+
+// RunOnce corrects the counters that differ from the votes and returns how
+// many were corrected. If another instance holds the lock it does nothing.
+func (r *Reconciler) RunOnce(ctx context.Context) (int64, error) {
+	fixed := int64(0)
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The lock is released when the transaction ends
+		locked := false
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", reconcileLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		result := tx.Exec(`
+			UPDATE videos v
+			SET vote_count = c.votes
+			FROM (
+				SELECT v.id, COUNT(vt.video_id) AS votes
+				FROM videos v
+				LEFT JOIN votes vt ON vt.video_id = v.id
+				GROUP BY v.id
+			) c
+			WHERE c.id = v.id AND v.vote_count <> c.votes
+			`)
+		fixed = result.RowsAffected
+		if result.Error != nil || fixed == 0 {
+			return result.Error
+		}
+		return Notify(tx, 0)
+	})
+
+	return fixed, err
+}
@@ -0,0 +1,71 @@
+package ranking
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Strategy is how the video ranking orders videos. Every strategy scores a
+// video from its vote counter, so the ranking stays as cheap as the counter.
+// Snapshots rank each contest with its own strategy and live updates with
+// the configured one.
+type Strategy string
+
+const (
+	// Votes of the video
+	StrategyRaw Strategy = "raw"
+	// Votes divided by the age of the video raised to a gravity, as Hacker
+	// News does, so recent videos can overtake older ones
+	StrategyTrending Strategy = "trending"
+	// Votes per view, pulled towards the site-wide rate until the video has
+	// enough views, so a few lucky votes do not top the ranking
+	StrategyBayesian Strategy = "bayesian"
+)
+
+// ParseStrategy validates a strategy name. Empty returns def.
+func ParseStrategy(name string, def Strategy) (Strategy, error) {
+	switch strategy := Strategy(strings.ToLower(strings.TrimSpace(name))); strategy {
+	case "":
+		return def, nil
+	case StrategyRaw, StrategyTrending, StrategyBayesian:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown ranking strategy %q", name)
+}
+
+// ContestStrategy returns the strategy a contest picked, or the configured
+// one when it picked none or an unknown one.
+func (c Config) ContestStrategy(name *string) Strategy {
+	if name == nil {
+		return c.Strategy
+	}
+	strategy, err := ParseStrategy(*name, c.Strategy)
+	if err != nil {
+		return c.Strategy
+	}
+	return strategy
+}
+
+// Score returns the SQL expression that scores a row of videos v with the
+// strategy, and its arguments. Higher scores rank first.
+func (c Config) Score(strategy Strategy) (string, []interface{}) {
+	switch strategy {
+	case StrategyTrending:
+		// Age in hours since the video was published; the +2 keeps brand new
+		// videos from dividing by almost nothing
+		return `v.vote_count / POWER(
+				EXTRACT(EPOCH FROM NOW() - COALESCE(v.processed_at, v.uploaded_at, NOW()))::float8 / 3600 + 2,
+				?::float8)`,
+			[]interface{}{c.TrendingGravity}
+	case StrategyBayesian:
+		// Views are only counted since they were introduced, so a video is
+		// never considered to have fewer views than votes
+		return `(v.vote_count + ?::float8 * (
+				SELECT COALESCE(SUM(p.vote_count)::float8 / NULLIF(SUM(GREATEST(p.view_count, p.vote_count)), 0), 0)
+				FROM videos p
+				WHERE p.status = 'processed'
+			)) / (GREATEST(v.view_count, v.vote_count) + ?::float8)`,
+			[]interface{}{c.BayesianPriorViews, c.BayesianPriorViews}
+	}
+	return "v.vote_count::float8", nil
+}
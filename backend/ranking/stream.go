@@ -0,0 +1,249 @@
+package ranking
+
+import (
+	"back-end-todolist/models"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// NotifyChannel is the Postgres channel votes are announced on. The payload
+// is the id of the video whose votes changed.
+const NotifyChannel = "ranking_votes"
+
+// Notify announces inside tx that the votes of the video changed; it is
+// delivered when tx commits. videoID 0 means several videos changed.
+func Notify(tx *gorm.DB, videoID uint) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", NotifyChannel, strconv.FormatUint(uint64(videoID), 10)).Error
+}
+
+// Change is a video whose position or votes changed, with the values it had
+// in the previous update (nil when it just entered the standings).
+type Change struct {
+	models.VideoRanking
+	PreviousRank  *int   `json:"previousRank"`
+	PreviousVotes *int64 `json:"previousVotes"`
+}
+
+// Update is what subscribers receive after a burst of votes.
+type Update struct {
+	Changes []Change `json:"changes"`
+	// Videos that left the standings
+	Removed []uint    `json:"removed"`
+	At      time.Time `json:"at"`
+}
+
+// Stream keeps the top of the video ranking of this instance up to date and
+// pushes its changes to subscribers. Every instance listens on NotifyChannel,
+// so a vote on any instance reaches every subscriber, and the standings are
+// recomputed once per debounce window whatever the number of subscribers.
+// Videos are ranked with the configured strategy.
+type Stream struct {
+	DB       *gorm.DB
+	Debounce time.Duration
+	Size     int
+	Config   Config
+
+	mu          sync.Mutex
+	standings   []models.VideoRanking
+	subscribers map[chan Update]struct{}
+}
+
+func NewStream(db *gorm.DB, config Config) *Stream {
+	return &Stream{
+		DB:          db,
+		Debounce:    config.StreamDebounce,
+		Size:        config.StreamSize,
+		Config:      config,
+		subscribers: map[chan Update]struct{}{},
+	}
+}
+
+// Subscribe returns the current standings and a channel with the updates
+// that follow them. The channel is closed if the subscriber falls behind, so
+// it can reconnect from a fresh snapshot. cancel must be called when done.
+func (s *Stream) Subscribe() ([]models.VideoRanking, <-chan Update, func()) {
+	updates := make(chan Update, 8)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[updates] = struct{}{}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[updates]; ok {
+			delete(s.subscribers, updates)
+			close(updates)
+		}
+	}
+	return s.standings, updates, cancel
+}
+
+// Run listens for votes until ctx is cancelled, reconnecting on errors.
+func (s *Stream) Run(ctx context.Context) {
+	for {
+		if err := s.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error listening for ranking changes: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// listen holds a connection of the pool for LISTEN. The first vote of a
+// burst starts the debounce window and the standings are refreshed when it
+// ends.
+func (s *Stream) listen(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+			return err
+		}
+		defer pgxConn.Exec(context.Background(), "UNLISTEN "+NotifyChannel)
+
+		// Votes missed while disconnected are picked up here
+		if err := s.refresh(ctx); err != nil {
+			return err
+		}
+
+		pending := false
+		var flushAt time.Time
+		for {
+			waitCtx, cancel := ctx, context.CancelFunc(func() {})
+			if pending {
+				waitCtx, cancel = context.WithDeadline(ctx, flushAt)
+			}
+			_, err := pgxConn.WaitForNotification(waitCtx)
+			cancel()
+
+			switch {
+			case err == nil:
+				if !pending {
+					pending = true
+					flushAt = time.Now().Add(s.Debounce)
+				}
+			case ctx.Err() != nil:
+				return nil
+			case pending && errors.Is(waitCtx.Err(), context.DeadlineExceeded):
+				pending = false
+				if err := s.refresh(ctx); err != nil {
+					log.Printf("Error refreshing ranking standings: %v", err)
+				}
+			default:
+				return err
+			}
+		}
+	})
+}
+
+// refresh recomputes the standings and sends what changed to subscribers.
+func (s *Stream) refresh(ctx context.Context) error {
+	standings := []models.VideoRanking{}
+	score, args := s.Config.Score(s.Config.Strategy)
+	err := s.DB.WithContext(ctx).Raw(`
+		WITH scored AS (
+			SELECT
+				v.id,
+				v.title,
+				v.vote_count,
+				v.view_count,
+				v.user_id,
+				`+score+` AS score
+			FROM videos v
+			WHERE v.status = 'processed'
+		)
+		SELECT
+			RANK() OVER (ORDER BY s.score DESC) AS rank,
+			s.id AS video_id,
+			s.title,
+			s.vote_count AS votes,
+			s.view_count AS views,
+			s.score,
+			u.id AS user_id,
+			u.handle,
+			u.display_name,
+			u.city
+		FROM scored s
+		JOIN users u ON u.id = s.user_id
+		ORDER BY rank, s.id
+		LIMIT ?
+		`, append(args, s.Size)...).
+		Scan(&standings).Error
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := Diff(s.standings, standings)
+	s.standings = standings
+	if len(update.Changes) == 0 && len(update.Removed) == 0 {
+		return nil
+	}
+	update.At = time.Now()
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- update:
+		default:
+			// Too slow: drop it so it resubscribes from a snapshot
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return nil
+}
+
+// Diff returns the videos of current whose rank or votes differ from
+// previous, and the videos of previous missing from current.
+func Diff(previous, current []models.VideoRanking) Update {
+	before := make(map[uint]models.VideoRanking, len(previous))
+	for _, row := range previous {
+		before[row.VideoID] = row
+	}
+
+	update := Update{Changes: []Change{}, Removed: []uint{}}
+	for _, row := range current {
+		old, ok := before[row.VideoID]
+		delete(before, row.VideoID)
+		if ok && old.Rank == row.Rank && old.Votes == row.Votes {
+			continue
+		}
+
+		change := Change{VideoRanking: row}
+		if ok {
+			change.PreviousRank = &old.Rank
+			change.PreviousVotes = &old.Votes
+		}
+		update.Changes = append(update.Changes, change)
+	}
+
+	for _, row := range previous {
+		if _, left := before[row.VideoID]; left {
+			update.Removed = append(update.Removed, row.VideoID)
+		}
+	}
+	return update
+}
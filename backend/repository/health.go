@@ -9,8 +9,8 @@ import (
 // @Summary      Health check
 // @Tags         health
 // @Produce      json
-// @Success      200  {string}  "Healh check passed"
-// @Router       /health/check
+// @Success      200  {string}  string  "Healh check passed"
+// @Router       /health/check [get]
 func (r *Repository) HealthCheck(context *fiber.Ctx) error {
 	context.Status(http.StatusOK).JSON(&fiber.Map{
 		"message": "Healh check passed",
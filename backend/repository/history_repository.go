@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Window of the trend shown with a history ("up 3 places today")
+const trendWindow = 24 * time.Hour
+
+// @Summary      Historial de posiciones de un video
+// @Description  Serie de posiciones, votos y puntaje del video dentro de su concurso, ordenado según la estrategia del concurso, tomada de los snapshots periódicos y finales. trend compara el último snapshot con el de 24 horas antes (rankChange positivo = subió)
+// @Tags         rankings
+// @Produce      json
+// @Param        videoId  path   int     true   "ID del video"
+// @Param        since    query  string  false  "Inicio de la serie (RFC 3339, por defecto 30 días atrás)"
+// @Success      200  {array}   models.RankingSnapshot
+// @Router       /public/rankings/videos/{videoId}/history [get]
+func (r *Repository) getVideoRankHistory(context *fiber.Ctx) error {
+	videoID, err := strconv.ParseUint(context.Params("videoId"), 10, 32)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "videoId inválido")
+	}
+
+	video := models.Video{}
+	if err := r.DB.Select("id", "contest_id").First(&video, videoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return context.Status(http.StatusNotFound).JSON(
+				&fiber.Map{"message": "Video no encontrado"})
+		}
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener el video"})
+	}
+
+	return r.rankHistory(context, models.SnapshotVideo, video.ID, video.ContestID)
+}
+
+// @Summary      Historial de posiciones de un jugador
+// @Description  Serie de posiciones y votos del jugador dentro de un concurso (sin contest_id, los videos fuera de concurso). trend compara el último snapshot con el de 24 horas antes (rankChange positivo = subió)
+// @Tags         rankings
+// @Produce      json
+// @Param        userId      path   int     true   "ID del jugador"
+// @Param        contest_id  query  int     false  "Concurso"
+// @Param        since       query  string  false  "Inicio de la serie (RFC 3339, por defecto 30 días atrás)"
+// @Success      200  {array}   models.RankingSnapshot
+// @Router       /public/rankings/players/{userId}/history [get]
+func (r *Repository) getPlayerRankHistory(context *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(context.Params("userId"), 10, 32)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "userId inválido")
+	}
+
+	var contestID *uint
+	if raw := context.Query("contest_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "contest_id inválido"})
+		}
+		value := uint(id)
+		contestID = &value
+	}
+
+	return r.rankHistory(context, models.SnapshotPlayer, uint(userID), contestID)
+}
+
+func (r *Repository) rankHistory(context *fiber.Ctx, scope string, subjectID uint, contestID *uint) error {
+	since := time.Now().AddDate(0, 0, -30)
+	if raw := context.Query("since"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "since debe tener formato RFC 3339"})
+		}
+		since = parsed
+	}
+
+	query := r.DB.Where("scope = ? AND subject_id = ? AND taken_at >= ?", scope, subjectID, since)
+	if contestID != nil {
+		query = query.Where("contest_id = ?", *contestID)
+	} else {
+		query = query.Where("contest_id IS NULL")
+	}
+
+	series := []models.RankingSnapshot{}
+	if err := query.Order("taken_at").Find(&series).Error; err != nil {
+		log.Printf("Error reading ranking history: %v", err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener el historial del ranking"})
+	}
+
+	return context.JSON(fiber.Map{
+		"message": "Historial del ranking obtenido correctamente",
+		"data":    series,
+		"trend":   rankTrend(series),
+	})
+}
+
+// rankTrend compares the last snapshot with the first one of the trend
+// window before it. Nil when there is nothing to compare.
+func rankTrend(series []models.RankingSnapshot) fiber.Map {
+	if len(series) < 2 {
+		return nil
+	}
+
+	last := series[len(series)-1]
+	first := last
+	for _, snapshot := range series {
+		if last.TakenAt.Sub(snapshot.TakenAt) <= trendWindow {
+			first = snapshot
+			break
+		}
+	}
+	if first.ID == last.ID {
+		return nil
+	}
+
+	return fiber.Map{
+		"since":       first.TakenAt,
+		"rankChange":  first.Rank - last.Rank,
+		"votesChange": last.Votes - first.Votes,
+	}
+}
+
+// @Summary      Posiciones finales de un concurso
+// @Description  Ranking congelado al cerrar la votación del concurso, que no cambia con votos posteriores. Los videos se ordenan según la estrategia del concurso (score); los jugadores, por sus votos agregados
+// @Tags         rankings
+// @Produce      json
+// @Param        contestId  path   int     true   "ID del concurso"
+// @Param        scope      query  string  false  "video (por defecto) o player"
+// @Success      200  {array}   models.RankingSnapshot
+// @Failure      409  {string}  string  "El concurso aún no tiene posiciones finales"
+// @Router       /public/contests/{contestId}/standings [get]
+func (r *Repository) getFinalStandings(context *fiber.Ctx) error {
+	contestID, err := strconv.ParseUint(context.Params("contestId"), 10, 64)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "contestId inválido")
+	}
+
+	scope := context.Query("scope", models.SnapshotVideo)
+	if scope != models.SnapshotVideo && scope != models.SnapshotPlayer {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "scope debe ser video o player"})
+	}
+
+	contest := models.Contest{}
+	if err := r.DB.First(&contest, contestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return context.Status(http.StatusNotFound).JSON(
+				&fiber.Map{"message": "Concurso no encontrado"})
+		}
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener el concurso"})
+	}
+	if contest.FinalizedAt == nil {
+		return context.Status(http.StatusConflict).JSON(
+			&fiber.Map{"message": "El concurso aún no tiene posiciones finales"})
+	}
+
+	standings := []models.RankingSnapshot{}
+	if err := r.DB.
+		Where("kind = ? AND scope = ? AND contest_id = ?", models.SnapshotFinal, scope, contest.ID).
+		Order("rank, subject_id").
+		Find(&standings).Error; err != nil {
+		log.Printf("Error reading final standings: %v", err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener las posiciones finales"})
+	}
+
+	return context.JSON(fiber.Map{
+		"message":      "Posiciones finales obtenidas correctamente",
+		"contest":      contest,
+		"finalized_at": contest.FinalizedAt,
+		"data":         standings,
+	})
+}
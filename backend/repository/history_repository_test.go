@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"testing"
+	"time"
+)
+
+func TestRankTrend(t *testing.T) {
+	now := time.Now()
+	snapshot := func(id uint, age time.Duration, rank int, votes int64) models.RankingSnapshot {
+		return models.RankingSnapshot{ID: id, TakenAt: now.Add(-age), Rank: rank, Votes: votes}
+	}
+
+	cases := []struct {
+		name        string
+		series      []models.RankingSnapshot
+		since       time.Time
+		rankChange  int
+		votesChange int64
+	}{
+		{
+			name:   "single snapshot",
+			series: []models.RankingSnapshot{snapshot(1, 0, 3, 10)},
+		},
+		{
+			name:        "climbed within the window",
+			series:      []models.RankingSnapshot{snapshot(1, 20*time.Hour, 5, 10), snapshot(2, 10*time.Hour, 4, 15), snapshot(3, 0, 2, 30)},
+			since:       now.Add(-20 * time.Hour),
+			rankChange:  3,
+			votesChange: 20,
+		},
+		{
+			name:        "snapshots before the window are skipped",
+			series:      []models.RankingSnapshot{snapshot(1, 48*time.Hour, 1, 0), snapshot(2, 24*time.Hour, 2, 10), snapshot(3, 0, 4, 12)},
+			since:       now.Add(-24 * time.Hour),
+			rankChange:  -2,
+			votesChange: 2,
+		},
+		{
+			name:   "nothing else within the window",
+			series: []models.RankingSnapshot{snapshot(1, 30*time.Hour, 1, 0), snapshot(2, 0, 2, 5)},
+		},
+	}
+
+	for _, c := range cases {
+		trend := rankTrend(c.series)
+		if c.since.IsZero() {
+			if trend != nil {
+				t.Errorf("%s: expected no trend, got %v", c.name, trend)
+			}
+			continue
+		}
+		if trend == nil {
+			t.Errorf("%s: expected a trend", c.name)
+			continue
+		}
+		if !trend["since"].(time.Time).Equal(c.since) || trend["rankChange"] != c.rankChange || trend["votesChange"] != c.votesChange {
+			t.Errorf("%s: expected since %s, rank %+d, votes %+d, got %v", c.name, c.since, c.rankChange, c.votesChange, trend)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"back-end-todolist/backpressure"
+	"back-end-todolist/ingest"
+	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// @Summary      Carga un video desde una URL
+// @Description  Registra el video en estado ingesting y lo descarga en segundo plano. Solo se aceptan URLs http(s) públicas; el estado se consulta en /videos/{video_id}
+// @Tags         videos
+// @Produce      json
+// @Param        video_url  formData  string  true  "URL del video"
+// @Param        title      formData  string  false "Título del video"
+// @Param        contest_id formData  int     false "Concurso al que se inscribe el video"
+// @Success      202 {object}  models.Video
+// @Failure      403 {string} string "Cuota de almacenamiento o de videos por concurso agotada"
+// @Failure      429 {string} string "Cuota diaria de cargas agotada, reintentar luego de Retry-After"
+// @Failure      503 {string} string "Cola de procesamiento saturada, reintentar luego de Retry-After"
+// @Router       /create_video_test [post]
+func (r *Repository) UploadVideoFromURL(ctx *fiber.Ctx) error {
+	userID := ctx.Locals("userID").(uint)
+
+	// URL ingestion is bulk/test traffic, so it is always low priority
+	decision, err := r.admitUpload(ctx, true)
+	if decision == backpressure.Reject {
+		return err
+	}
+
+	videoURL := ctx.FormValue("video_url")
+	title := ctx.FormValue("title")
+
+	if videoURL == "" {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"message": "Missing video_url field",
+		})
+	}
+	if _, err := ingest.ValidateURL(videoURL); err != nil {
+		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"message": "video_url must be an http or https URL",
+		})
+	}
+
+	contestID, ok := r.resolveContest(ctx, ctx.FormValue("contest_id"))
+	if !ok {
+		return nil
+	}
+
+	status := "ingesting"
+	now := time.Now()
+	video := models.Video{
+		UserID:         userID,
+		Title:          &title,
+		Status:         &status,
+		UploadedAt:     &now,
+		ContestID:      contestID,
+		SourceURL:      &videoURL,
+		IngestAttempts: 1,
+	}
+	// The size is unknown until the download ends, so the byte quota is
+	// checked when the video is stored
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := r.enforceQuota(tx, r.Quota, userID, contestID, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&video).Error; err != nil {
+			return err
+		}
+		return recordUpload(tx, &video)
+	})
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) {
+		return quotaExceeded(ctx, exceeded)
+	}
+	if err != nil {
+		return videoCreationFailed(ctx, fmt.Errorf("%w: %v", errStoreVideo, err))
+	}
+
+	go r.ingestVideo(video, videoURL)
+
+	return ctx.Status(http.StatusAccepted).JSON(fiber.Map{
+		"message":    "Ingestion scheduled.",
+		"video":      video,
+		"status_url": fmt.Sprintf("/api/videos/%d", video.ID),
+	})
+}
+
+// ingestVideo downloads the remote original of an ingesting video into
+// storage and hands it to processing, or marks the video ingest_failed with
+// the reason.
+func (r *Repository) ingestVideo(video models.Video, videoURL string) {
+	// Waiting for a download slot counts towards the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 2*r.Ingest.Config.Timeout)
+	defer cancel()
+
+	if err := r.Ingest.Acquire(ctx); err != nil {
+		r.failIngestion(video.ID, "Ingestion timed out waiting for a download slot")
+		return
+	}
+	defer r.Ingest.Release()
+
+	reason, err := r.storeIngestedVideo(ctx, &video, videoURL)
+	if err != nil {
+		log.Printf("Error ingesting video %d: %v", video.ID, err)
+		r.failIngestion(video.ID, reason)
+	}
+}
+
+// storeIngestedVideo returns the reason shown to the user along with any
+// error, so internal details stay in the logs.
+func (r *Repository) storeIngestedVideo(ctx context.Context, video *models.Video, videoURL string) (string, error) {
+	download, err := r.Ingest.Fetch(ctx, videoURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, ingest.ErrBlockedAddress):
+			return "The URL points to a private or reserved address", err
+		case errors.Is(err, ingest.ErrTooManyRedirects):
+			return "The URL redirects too many times", err
+		case errors.Is(err, ingest.ErrTooLarge):
+			return "The remote file is too large", err
+		case errors.Is(err, ingest.ErrNotVideo):
+			return "The remote file is not a video", err
+		}
+		return "The video could not be downloaded", err
+	}
+	defer download.Body.Close()
+
+	store := r.Store
+
+	stagingKey := fmt.Sprintf("uploads/staging/%d_%s", video.UserID, uuid.NewString())
+	hasher := sha256.New()
+	body := &countingReader{r: io.TeeReader(download.Body, hasher)}
+	if err := store.Upload(ctx, stagingKey, body, download.ContentType); err != nil {
+		store.Delete(ctx, stagingKey)
+		if errors.Is(err, ingest.ErrTooLarge) {
+			return "The remote file is too large", err
+		}
+		return "The video could not be downloaded", err
+	}
+	video.SizeBytes = &body.n
+
+	existing, err := r.storeOriginal(ctx, store, video, stagingKey, hex.EncodeToString(hasher.Sum(nil)))
+	if errors.Is(err, errDuplicateVideo) {
+		return fmt.Sprintf("Duplicate of video %d", existing.ID), err
+	}
+	if err != nil {
+		return "Internal error storing the video", err
+	}
+
+	quarantine, err := r.scanOriginal(ctx, video)
+	if err != nil {
+		return "Internal error storing the video", err
+	}
+
+	decision := r.storedUploadDecision(ctx, true)
+	status := "uploaded"
+	if decision == backpressure.Defer {
+		status = "deferred"
+	}
+	if quarantine != nil {
+		status = *video.Status
+	}
+
+	// The video may have been deleted while it was downloading. Its contest
+	// slot and daily upload were taken when it was registered, so only the
+	// byte quota is left to check
+	stored := int64(0)
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if quarantine == nil {
+			bytesOnly := quota.Limits{TotalBytes: r.Quota.TotalBytes}
+			if err := r.enforceQuota(tx, bytesOnly, video.UserID, nil, *video.SizeBytes); err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&models.Video{}).
+			Where("id = ? AND status = ?", video.ID, "ingesting").
+			Updates(map[string]interface{}{
+				"status":          status,
+				"status_reason":   video.StatusReason,
+				"original_key":    video.OriginalKey,
+				"size_bytes":      video.SizeBytes,
+				"checksum_sha256": video.ChecksumSHA256,
+				"duplicate_of_id": video.DuplicateOfID,
+				"review_reason":   video.ReviewReason,
+				"uploaded_at":     time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		stored = result.RowsAffected
+		if quarantine == nil {
+			return nil
+		}
+		return tx.Create(quarantine).Error
+	})
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) {
+		r.dropOriginal(ctx, video)
+		return "Storage quota exceeded", err
+	}
+	if isUniqueViolation(err) {
+		// The user stored the same content while this one was downloading;
+		// both share the original
+		existing := models.Video{UserID: video.UserID, ChecksumSHA256: video.ChecksumSHA256}
+		if err := r.loadDuplicate(ctx, &existing); errors.Is(err, errDuplicateVideo) {
+			return fmt.Sprintf("Duplicate of video %d", existing.ID), err
+		}
+	}
+	if err != nil {
+		return "Internal error storing the video", fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+	if stored == 0 || quarantine != nil {
+		return "", nil
+	}
+
+	// If the queue is unavailable the video is requeued later
+	r.scheduleVideo(ctx, video.ID, r.enqueueDelay(decision))
+	return "", nil
+}
+
+func (r *Repository) failIngestion(videoID uint, reason string) {
+	err := r.DB.Model(&models.Video{}).
+		Where("id = ? AND status = ?", videoID, "ingesting").
+		Updates(map[string]interface{}{
+			"status":        "ingest_failed",
+			"status_reason": reason,
+		}).Error
+	if err != nil {
+		log.Printf("Error marking video %d as ingest_failed: %v", videoID, err)
+	}
+}
+
+// maxIngestAttempts bounds how many times an interrupted ingestion is
+// started again before it is marked failed.
+const maxIngestAttempts = 3
+
+// RetryStaleIngestions restarts the ingestions that outlived their deadline,
+// which happens when the instance running them restarts, and marks failed
+// the ones that already used their attempts. Rows are locked while they are
+// claimed, so a single instance restarts each one.
+func (r *Repository) RetryStaleIngestions(ctx context.Context) error {
+	cutoff := time.Now().Add(-3 * r.Ingest.Config.Timeout)
+	retry := []models.Video{}
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stale := []models.Video{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND uploaded_at < ?", "ingesting", cutoff).
+			Limit(100).
+			Find(&stale).Error; err != nil {
+			return err
+		}
+
+		for _, video := range stale {
+			if video.SourceURL == nil || video.IngestAttempts >= maxIngestAttempts {
+				if err := tx.Model(&video).Updates(map[string]interface{}{
+					"status":        "ingest_failed",
+					"status_reason": "Ingestion was interrupted, upload the video again",
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			// The claim restarts the deadline of the new attempt
+			now := time.Now()
+			if err := tx.Model(&video).Updates(map[string]interface{}{
+				"uploaded_at":     now,
+				"ingest_attempts": video.IngestAttempts + 1,
+			}).Error; err != nil {
+				return err
+			}
+			video.UploadedAt = &now
+			retry = append(retry, video)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, video := range retry {
+		log.Printf("Restarting interrupted ingestion of video %d", video.ID)
+		go r.ingestVideo(video, *video.SourceURL)
+	}
+	return nil
+}
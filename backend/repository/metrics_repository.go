@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// @Summary      Obtiene las métricas de procesamiento para autoescalado
+// @Description  Profundidad de la cola, antigüedad del video pendiente más viejo, trabajos en curso por worker y p50/p95 desde la carga hasta el procesamiento
+// @Tags         metrics
+// @Produce      json
+// @Param        window  query  string  false  "Ventana para los percentiles (ej. 15m, 1h)"  default(1h)
+// @Success      200  {object}  metrics.ProcessingStats
+// @Router       /metrics/processing [get]
+func (r *Repository) getProcessingMetrics(context *fiber.Ctx) error {
+
+	window, err := time.ParseDuration(context.Query("window", "1h"))
+	if err != nil || window <= 0 {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "window inválido"},
+		)
+	}
+
+	stats, err := r.Metrics.Collect(context.UserContext(), window)
+	if err != nil {
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener las métricas de procesamiento"},
+		)
+	}
+
+	context.Status(http.StatusOK).JSON(&fiber.Map{
+		"message": "Se obtuvieron las métricas de procesamiento correctamente",
+		"data":    stats,
+	})
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"back-end-todolist/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+var (
+	errInvalidForm      = errors.New("invalid multipart form")
+	errMissingVideoFile = errors.New("missing video file")
+	errUploadTooLarge   = errors.New("upload exceeds the maximum size")
+)
+
+// Longest title accepted from the form
+const maxTitleBytes = 1024
+
+type streamedUpload struct {
+	Title          string
+	ObjectKey      string
+	ContentType    string
+	Size           int64
+	ChecksumSHA256 string
+}
+
+// streamVideoForm reads the UploadVideo form part by part and streams
+// video_file straight into storage, enforcing the size limit and computing
+// its SHA-256 on the fly. Nothing is written to local disk.
+func (r *Repository) streamVideoForm(ctx *fiber.Ctx, store *storage.ObjectStore, userID uint) (*streamedUpload, error) {
+	_, params, err := mime.ParseMediaType(ctx.Get(fiber.HeaderContentType))
+	if err != nil || params["boundary"] == "" {
+		return nil, errInvalidForm
+	}
+
+	form := multipart.NewReader(r.requestBody(ctx), params["boundary"])
+	upload := &streamedUpload{}
+
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return upload, fmt.Errorf("%w: %v", errInvalidForm, err)
+		}
+
+		switch part.FormName() {
+		case "title":
+			title, err := io.ReadAll(io.LimitReader(part, maxTitleBytes))
+			if err != nil {
+				return upload, fmt.Errorf("%w: %v", errInvalidForm, err)
+			}
+			upload.Title = string(title)
+
+		case "video_file":
+			if upload.ObjectKey != "" {
+				return upload, fmt.Errorf("%w: more than one video_file", errInvalidForm)
+			}
+			if err := streamVideoPart(ctx, store, part, userID, upload); err != nil {
+				return upload, err
+			}
+		}
+
+		part.Close()
+	}
+
+	if upload.ObjectKey == "" {
+		return upload, errMissingVideoFile
+	}
+
+	return upload, nil
+}
+
+func streamVideoPart(ctx *fiber.Ctx, store *storage.ObjectStore, part *multipart.Part, userID uint, upload *streamedUpload) error {
+	// The final key depends on the content, so the bytes land in a staging
+	// key until their checksum is known
+	upload.ObjectKey = fmt.Sprintf("uploads/staging/%d_%s", userID, uuid.NewString())
+	upload.ContentType = part.Header.Get(fiber.HeaderContentType)
+
+	hasher := sha256.New()
+	limited := &maxBytesReader{r: part, remaining: maxUploadBytes}
+	body := &countingReader{r: io.TeeReader(limited, hasher)}
+
+	err := store.Upload(ctx.UserContext(), upload.ObjectKey, body, upload.ContentType)
+	if limited.exceeded {
+		store.Delete(ctx.UserContext(), upload.ObjectKey)
+		return errUploadTooLarge
+	}
+	if err != nil {
+		return err
+	}
+
+	upload.Size = body.n
+	upload.ChecksumSHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// maxBytesReader fails once more than remaining bytes have been read.
+type maxBytesReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.exceeded {
+		return 0, errUploadTooLarge
+	}
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		m.exceeded = true
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
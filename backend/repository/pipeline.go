@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"back-end-todolist/backpressure"
+	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"back-end-todolist/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errStoreVideo  = errors.New("error storing video in DB")
+	errStoreObject = errors.New("error storing original in S3")
+
+	// errDuplicateVideo is returned with the video the user had already
+	// uploaded with the same content
+	errDuplicateVideo = errors.New("duplicate upload")
+)
+
+// contentKey is where an original is kept. The key is the SHA-256 (hex) of
+// its bytes, so identical uploads share a single object.
+func contentKey(checksumHex string) string {
+	return "uploads/sha256/" + checksumHex
+}
+
+// storeOriginal moves an uploaded object to its content-addressed key and
+// sets the video's original, checksum and duplicate fields. If the same user
+// already uploaded these bytes, their video is returned with
+// errDuplicateVideo and the new object is dropped. If another user did, the
+// video is flagged for review.
+func (r *Repository) storeOriginal(ctx context.Context, store *storage.ObjectStore, video *models.Video, uploadedKey, checksumHex string) (*models.Video, error) {
+	key := contentKey(checksumHex)
+
+	existing := models.Video{}
+	err := r.DB.WithContext(ctx).
+		Where("checksum_sha256 = ? AND user_id = ?", checksumHex, video.UserID).
+		Order("id").
+		First(&existing).Error
+	if err == nil {
+		if uploadedKey != aws.ToString(existing.OriginalKey) {
+			if err := store.Delete(ctx, uploadedKey); err != nil {
+				log.Printf("Error deleting duplicate upload %s: %v", uploadedKey, err)
+			}
+		}
+		return &existing, errDuplicateVideo
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	if uploadedKey != key {
+		// Copying even when the key exists refreshes an object that may be
+		// queued for deletion by a video that was just removed. The deletion
+		// runner holds the same lock and keeps recently copied objects
+		err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := models.LockObject(tx, key); err != nil {
+				return err
+			}
+			return store.Copy(ctx, uploadedKey, key)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errStoreObject, err)
+		}
+		if err := store.Delete(ctx, uploadedKey); err != nil {
+			log.Printf("Error deleting staged upload %s: %v", uploadedKey, err)
+		}
+	}
+	video.OriginalKey = &key
+	video.ChecksumSHA256 = &checksumHex
+
+	original := models.Video{}
+	err = r.DB.WithContext(ctx).
+		Where("checksum_sha256 = ? AND user_id <> ?", checksumHex, video.UserID).
+		Order("id").
+		First(&original).Error
+	if err == nil {
+		reason := "duplicate_content"
+		video.DuplicateOfID = &original.ID
+		video.ReviewReason = &reason
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	return nil, nil
+}
+
+// createVideo stores the record of a video whose original is already in
+// storage and schedules its processing. Every upload flow ends here. Videos
+// whose original fails the file scan are stored rejected and returned with
+// errVideoRejected. If the user stored the same content meanwhile, video
+// becomes that one and errDuplicateVideo is returned. Once the record is
+// stored the video is not lost if the queue is unavailable: it is returned
+// without a task id and RequeueStrandedVideos queues it later.
+func (r *Repository) createVideo(ctx context.Context, video *models.Video, decision backpressure.Decision) (*string, error) {
+	quarantine, err := r.scanOriginal(ctx, video)
+	if err != nil {
+		return nil, err
+	}
+	if quarantine != nil {
+		now := time.Now()
+		video.UploadedAt = &now
+
+		err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := insertVideo(tx, video); err != nil {
+				return err
+			}
+			if err := recordUpload(tx, video); err != nil {
+				return err
+			}
+			quarantine.VideoID = video.ID
+			return tx.Create(quarantine).Error
+		})
+		if errors.Is(err, errDuplicateVideo) {
+			return nil, r.loadDuplicate(ctx, video)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+		}
+		return nil, errVideoRejected
+	}
+
+	status := "uploaded"
+	if decision == backpressure.Defer {
+		status = "deferred"
+	}
+	now := time.Now()
+	video.Status = &status
+	video.UploadedAt = &now
+
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := r.enforceQuota(tx, r.Quota, video.UserID, video.ContestID, aws.ToInt64(video.SizeBytes)); err != nil {
+			return err
+		}
+		if err := insertVideo(tx, video); err != nil {
+			return err
+		}
+		return recordUpload(tx, video)
+	})
+	if errors.Is(err, errDuplicateVideo) {
+		return nil, r.loadDuplicate(ctx, video)
+	}
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) {
+		r.dropOriginal(ctx, video)
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	return r.scheduleVideo(ctx, video.ID, r.enqueueDelay(decision)), nil
+}
+
+// insertVideo stores a new video record. The unique index on checksum and
+// user settles concurrent uploads of the same content by one user, which
+// storeOriginal cannot: the one stored last gets errDuplicateVideo.
+func insertVideo(tx *gorm.DB, video *models.Video) error {
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "checksum_sha256"}, {Name: "user_id"}},
+		DoNothing: true,
+	}).Create(video)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errDuplicateVideo
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// loadDuplicate replaces video with the one the user already stored with the
+// same content and returns errDuplicateVideo. Both share the original, so
+// there is nothing to drop.
+func (r *Repository) loadDuplicate(ctx context.Context, video *models.Video) error {
+	existing := models.Video{}
+	if err := r.DB.WithContext(ctx).
+		Where("checksum_sha256 = ? AND user_id = ?", video.ChecksumSHA256, video.UserID).
+		First(&existing).Error; err != nil {
+		return fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+	*video = existing
+	return errDuplicateVideo
+}
+
+// scheduleVideo queues the processing of a stored video and records that it
+// was queued. On failure it returns nil and the video is left for
+// RequeueStrandedVideos.
+func (r *Repository) scheduleVideo(ctx context.Context, videoID uint, delaySeconds int32) *string {
+	taskID, err := r.enqueueVideo(ctx, videoID, delaySeconds)
+	if err != nil {
+		log.Printf("Error enqueueing video %d, it will be requeued: %v", videoID, err)
+		return nil
+	}
+	if err := r.DB.WithContext(ctx).Model(&models.Video{}).
+		Where("id = ?", videoID).
+		Update("enqueued_at", time.Now()).Error; err != nil {
+		// The worker skips processed videos, so a second message is harmless
+		log.Printf("Error recording enqueue of video %d: %v", videoID, err)
+	}
+	return taskID
+}
+
+// strandedAfter is how long a stored video may wait for its first enqueue
+// before RequeueStrandedVideos takes over, so requests still in flight are
+// not queued twice.
+const strandedAfter = 2 * time.Minute
+
+// RequeueStrandedVideos queues the videos that were stored but whose enqueue
+// failed or never happened (the instance stopped right after storing them).
+// Rows are locked while they are queued, so instances do not queue the same
+// video at once.
+func (r *Repository) RequeueStrandedVideos(ctx context.Context) (int, error) {
+	requeued := 0
+	var enqueueErr error
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		videos := []models.Video{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("id").
+			Where("status IN ? AND enqueued_at IS NULL AND uploaded_at < ?",
+				[]string{"uploaded", "deferred"}, time.Now().Add(-strandedAfter)).
+			Order("id").
+			Limit(100).
+			Find(&videos).Error; err != nil {
+			return err
+		}
+
+		for _, video := range videos {
+			// The videos queued so far are committed; the rest wait for the
+			// next run
+			if _, err := r.enqueueVideo(ctx, video.ID, 0); err != nil {
+				enqueueErr = err
+				return nil
+			}
+			if err := tx.Model(&video).Update("enqueued_at", time.Now()).Error; err != nil {
+				return err
+			}
+			requeued++
+		}
+		return nil
+	})
+	if err == nil {
+		err = enqueueErr
+	}
+
+	return requeued, err
+}
+
+func (r *Repository) enqueueVideo(ctx context.Context, videoID uint, delaySeconds int32) (*string, error) {
+	payload := map[string]interface{}{
+		"video_id": videoID,
+	}
+	body, _ := json.Marshal(payload)
+
+	resp, err := r.SQS.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     &r.QueueURL,
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: delaySeconds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.MessageId, nil
+}
+
+// dropOriginal queues the deletion of the original of a video that was not
+// stored. The deletion runner keeps it if another video references it.
+func (r *Repository) dropOriginal(ctx context.Context, video *models.Video) {
+	if video.OriginalKey == nil {
+		return
+	}
+	err := r.DB.WithContext(ctx).Create(&models.StorageDeletion{
+		ObjectKey:     *video.OriginalKey,
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Error queueing deletion of %s: %v", *video.OriginalKey, err)
+	}
+}
+
+// videoCreationFailed writes the response for an error returned by createVideo.
+func videoCreationFailed(ctx *fiber.Ctx, err error) error {
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) {
+		return quotaExceeded(ctx, exceeded)
+	}
+
+	message := "Error storing in DB"
+	switch {
+	case errors.Is(err, errStoreObject):
+		message = "Error uploading to S3"
+	}
+	log.Printf("Error creating video: %v", err)
+
+	return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
+		"message": message,
+	})
+}
+
+// duplicateVideo writes the response for an upload whose content the user
+// had already uploaded, returning their existing video.
+func duplicateVideo(ctx *fiber.Ctx, store *storage.ObjectStore, video *models.Video) error {
+	signVideoURLs(ctx.UserContext(), store, true, video)
+
+	return ctx.JSON(fiber.Map{
+		"message":   "Duplicate upload, returning existing video",
+		"video":     video,
+		"duplicate": true,
+	})
+}
+
+// admitUpload applies the backlog thresholds to a new upload. When the upload
+// is rejected the 503 response has already been written.
+func (r *Repository) admitUpload(ctx *fiber.Ctx, lowPriority bool) (backpressure.Decision, error) {
+	decision, backlog := r.Backpressure.Check(ctx.UserContext(), lowPriority)
+
+	if decision == backpressure.Reject {
+		retryAfter := int(r.Backpressure.Config.RetryAfter.Seconds())
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return decision, ctx.Status(http.StatusServiceUnavailable).JSON(fiber.Map{
+			"message": "Processing backlog is full, retry later",
+			"backlog": backlog,
+		})
+	}
+
+	return decision, nil
+}
+
+// storedUploadDecision applies the backlog thresholds to an upload whose bytes
+// are already in storage, so a full backlog defers it instead of rejecting it.
+func (r *Repository) storedUploadDecision(ctx context.Context, lowPriority bool) backpressure.Decision {
+	decision, _ := r.Backpressure.Check(ctx, lowPriority)
+	if decision == backpressure.Reject {
+		return backpressure.Defer
+	}
+	return decision
+}
+
+// enqueueDelay postpones deferred uploads, capped at the SQS maximum of 15 minutes.
+func (r *Repository) enqueueDelay(decision backpressure.Decision) int32 {
+	if decision != backpressure.Defer {
+		return 0
+	}
+	delay := r.Backpressure.Config.DeferDelay
+	if delay > 15*time.Minute {
+		delay = 15 * time.Minute
+	}
+	return int32(delay.Seconds())
+}
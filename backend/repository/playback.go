@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/storage"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// playbackURLTTL is how long the signed URLs returned by the API stay valid.
+func playbackURLTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("PLAYBACK_URL_TTL"))
+	if err != nil || ttl <= 0 {
+		return 15 * time.Minute
+	}
+	return ttl
+}
+
+// signVideoURLs fills the playback URLs of the videos from their object keys,
+// so the bucket can stay private. Originals are only signed for their owner.
+func signVideoURLs(ctx context.Context, store *storage.ObjectStore, includeOriginal bool, videos ...*models.Video) error {
+	ttl := playbackURLTTL()
+
+	for _, video := range videos {
+		if includeOriginal && video.OriginalKey != nil && *video.OriginalKey != "" {
+			url, err := store.PresignGet(ctx, *video.OriginalKey, ttl)
+			if err != nil {
+				return err
+			}
+			video.OriginalURL = &url
+		}
+
+		if video.ProcessedKey != nil && *video.ProcessedKey != "" {
+			url, err := store.PresignGet(ctx, *video.ProcessedKey, ttl)
+			if err != nil {
+				return err
+			}
+			video.ProcessedURL = &url
+		}
+
+		if video.ThumbnailKey != nil && *video.ThumbnailKey != "" {
+			url, err := store.PresignGet(ctx, *video.ThumbnailKey, ttl)
+			if err != nil {
+				return err
+			}
+			video.ThumbnailURL = &url
+		}
+	}
+
+	return nil
+}
+
+// signVideoList signs the playback URLs of the videos in place. When it
+// returns false the error response has already been written.
+func (r *Repository) signVideoList(context *fiber.Ctx, includeOriginal bool, videos []models.Video) bool {
+	refs := make([]*models.Video, len(videos))
+	for i := range videos {
+		refs[i] = &videos[i]
+	}
+	if err := signVideoURLs(context.UserContext(), r.Store, includeOriginal, refs...); err != nil {
+		log.Printf("Error signing playback URLs: %v", err)
+		context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al generar las URLs de reproducción"},
+		)
+		return false
+	}
+
+	return true
+}
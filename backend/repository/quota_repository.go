@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Videos in these states hold neither a contest slot nor storage
+var quotaFreeStatuses = []string{"rejected", "ingest_failed"}
+
+// How long the upload log is kept; only the daily window is counted
+const uploadEventsKept = 2 * quota.Day
+
+// quotaUsage measures what the user has consumed. The daily upload rate is
+// counted from the upload log, so rejected, failed and deleted videos still
+// count. Videos without a contest are not limited per contest.
+func quotaUsage(db *gorm.DB, userID uint, contestID *uint, now time.Time) (quota.Usage, error) {
+	usage := quota.Usage{}
+	since := now.Add(-quota.Day)
+
+	err := db.Raw(`
+		SELECT
+			COUNT(*) FILTER (WHERE status NOT IN ? AND contest_id = ?) AS videos_in_contest,
+			COALESCE(SUM(size_bytes) FILTER (WHERE status NOT IN ? AND original_key IS NOT NULL), 0) AS total_bytes
+		FROM videos
+		WHERE user_id = ?
+		`, quotaFreeStatuses, contestID, quotaFreeStatuses, userID).
+		Scan(&usage).Error
+	if err != nil {
+		return usage, err
+	}
+
+	err = db.Model(&models.UploadEvent{}).
+		Select("COUNT(*) AS uploads_today, MIN(created_at) AS oldest_upload_today").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&usage).Error
+
+	return usage, err
+}
+
+// recordUpload adds a stored video to the upload log inside tx.
+func recordUpload(tx *gorm.DB, video *models.Video) error {
+	return tx.Create(&models.UploadEvent{UserID: video.UserID, VideoID: video.ID}).Error
+}
+
+// enforceQuota checks the quotas for one more video of size bytes inside tx.
+// The user row is locked first, so concurrent uploads of the same user are
+// checked one at a time against up to date usage. Returns *quota.Exceeded
+// when a quota would be exceeded.
+func (r *Repository) enforceQuota(tx *gorm.DB, limits quota.Limits, userID uint, contestID *uint, size int64) error {
+	if limits == (quota.Limits{}) {
+		return nil
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&models.User{}, userID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	usage, err := quotaUsage(tx, userID, contestID, now)
+	if err != nil {
+		return err
+	}
+
+	if exceeded := limits.Check(usage, size, now); exceeded != nil {
+		return exceeded
+	}
+	return nil
+}
+
+// precheckQuota rejects an upload before its bytes are received. It is not
+// atomic; createVideo enforces the quotas again when the video is stored.
+// When the upload is rejected the response has already been written.
+func (r *Repository) precheckQuota(ctx *fiber.Ctx, userID uint, contestID *uint, size int64) bool {
+	now := time.Now()
+	usage, err := quotaUsage(r.DB.WithContext(ctx.UserContext()), userID, contestID, now)
+	if err != nil {
+		// The quota is enforced again when the video is stored
+		return true
+	}
+
+	if exceeded := r.Quota.Check(usage, size, now); exceeded != nil {
+		quotaExceeded(ctx, exceeded)
+		return false
+	}
+	return true
+}
+
+// quotaExceeded writes the 429 or 403 response for an exceeded quota.
+func quotaExceeded(ctx *fiber.Ctx, exceeded *quota.Exceeded) error {
+	if exceeded.RetryAfter > 0 {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(exceeded.RetryAfter.Seconds())))
+	}
+	return ctx.Status(exceeded.Status).JSON(fiber.Map{
+		"message": exceeded.Message,
+		"limit":   exceeded.Limit,
+	})
+}
+
+// resolveContest validates the contest_id an upload is submitted to. Empty
+// means no contest. When the contest is invalid the response has already
+// been written.
+func (r *Repository) resolveContest(ctx *fiber.Ctx, raw string) (*uint, bool) {
+	if raw == "" {
+		return nil, true
+	}
+
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		ctx.Status(http.StatusBadRequest).JSON(fiber.Map{"message": "contest_id inválido"})
+		return nil, false
+	}
+
+	contest := models.Contest{}
+	if err := r.DB.First(&contest, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.Status(http.StatusNotFound).JSON(fiber.Map{"message": "Concurso no encontrado"})
+		} else {
+			ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{"message": "Error al obtener el concurso"})
+		}
+		return nil, false
+	}
+
+	if contest.Closed(time.Now()) {
+		ctx.Status(http.StatusForbidden).JSON(fiber.Map{"message": "El concurso está cerrado"})
+		return nil, false
+	}
+
+	contestID := contest.ID
+	return &contestID, true
+}
+
+// @Summary      Consulta las cuotas de carga del usuario
+// @Description  Límites configurados, consumo actual y saldo disponible (null = sin límite). La cuota diaria es una ventana móvil de 24 horas
+// @Tags         uploads
+// @Produce      json
+// @Param        contest_id  query  int  false  "Concurso para el límite de videos por concurso"
+// @Success      200 {object}  quota.Remaining
+// @Router       /me/quota [get]
+func (r *Repository) getMyQuota(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+
+	var contestID *uint
+	if raw := context.Query("contest_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "contest_id inválido"})
+		}
+		value := uint(id)
+		contestID = &value
+	}
+
+	usage, err := quotaUsage(r.DB.WithContext(context.UserContext()), userID, contestID, time.Now())
+	if err != nil {
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener las cuotas"})
+	}
+
+	return context.JSON(fiber.Map{
+		"message":   "Cuotas obtenidas correctamente",
+		"limits":    r.Quota,
+		"usage":     usage,
+		"remaining": r.Quota.Remaining(usage),
+	})
+}
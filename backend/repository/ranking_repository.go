@@ -2,32 +2,426 @@ package repository
 
 import (
 	"back-end-todolist/models"
+	"back-end-todolist/ranking"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// @Summary      Obtiene los rankings de los videos votados
+const (
+	defaultRankingLimit = 50
+	maxRankingLimit     = 200
+)
+
+// rankingFilter selects the videos a ranking is computed over and the page
+// of it to return. Positions are computed after filtering, so they are the
+// positions within the city, country, contest or user type.
+type rankingFilter struct {
+	City      string
+	Country   string
+	UserType  string
+	ContestID *uint
+	Limit     int
+	Offset    int
+}
+
+func parseRankingFilter(context *fiber.Ctx) (rankingFilter, error) {
+	filter := rankingFilter{
+		City:     strings.TrimSpace(context.Query("city")),
+		Country:  strings.TrimSpace(context.Query("country")),
+		UserType: strings.TrimSpace(context.Query("user_type")),
+		Limit:    defaultRankingLimit,
+	}
+
+	if raw := context.Query("contest_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return filter, errors.New("contest_id inválido")
+		}
+		contestID := uint(id)
+		filter.ContestID = &contestID
+	}
+
+	if raw := context.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxRankingLimit {
+			return filter, errors.New("limit debe estar entre 1 y " + strconv.Itoa(maxRankingLimit))
+		}
+		filter.Limit = limit
+	}
+
+	if raw := context.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return filter, errors.New("offset inválido")
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// where returns the conditions on videos v and users u for the filter.
+func (f rankingFilter) where() (string, []interface{}) {
+	conditions := []string{"v.status = 'processed'"}
+	args := []interface{}{}
+
+	if f.City != "" {
+		conditions = append(conditions, "LOWER(u.city) = LOWER(?)")
+		args = append(args, f.City)
+	}
+	if f.Country != "" {
+		conditions = append(conditions, "LOWER(u.country) = LOWER(?)")
+		args = append(args, f.Country)
+	}
+	if f.UserType != "" {
+		conditions = append(conditions, "u.type = ?")
+		args = append(args, f.UserType)
+	}
+	if f.ContestID != nil {
+		conditions = append(conditions, "v.contest_id = ?")
+		args = append(args, *f.ContestID)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// key identifies the page of the ranking the filter selects.
+func (f rankingFilter) key() string {
+	contestID := ""
+	if f.ContestID != nil {
+		contestID = strconv.FormatUint(uint64(*f.ContestID), 10)
+	}
+	return strings.Join([]string{
+		strconv.Quote(strings.ToLower(f.City)),
+		strconv.Quote(strings.ToLower(f.Country)),
+		strconv.Quote(f.UserType),
+		contestID,
+		strconv.Itoa(f.Limit),
+		strconv.Itoa(f.Offset),
+	}, "|")
+}
+
+// RankingPage describes the page of a ranking response; NextOffset is null
+// on the last page.
+type RankingPage struct {
+	Limit      int   `json:"limit"`
+	Offset     int   `json:"offset"`
+	Total      int64 `json:"total"`
+	NextOffset *int  `json:"next_offset"`
+}
+
+func (f rankingFilter) pagination(total int64) RankingPage {
+	page := RankingPage{Limit: f.Limit, Offset: f.Offset, Total: total}
+	if int64(f.Offset+f.Limit) < total {
+		next := f.Offset + f.Limit
+		page.NextOffset = &next
+	}
+	return page
+}
+
+// @Summary      Obtiene el ranking de jugadores
+// @Description  El puntaje de cada jugador agrega los votos de sus videos procesados según mode: sum (todos), max (su mejor video) o best (sus n mejores videos). Sin mode se usa el configurado.
+// @Description  Los filtros se aplican antes de calcular las posiciones. Desempate: jugadores con el mismo puntaje comparten la posición (1, 1, 3) y se listan por id de usuario ascendente.
 // @Tags         rankings
 // @Produce      json
-// @Success      200  {array}   models.RankingView
+// @Param        mode        query  string  false  "Agregación de votos (sum, max, best)"
+// @Param        n           query  int     false  "Videos contados por jugador en mode=best"
+// @Param        city        query  string  false  "Ciudad del jugador"
+// @Param        country     query  string  false  "País del jugador"
+// @Param        contest_id  query  int     false  "Concurso de los videos"
+// @Param        user_type   query  string  false  "Tipo de usuario del jugador"
+// @Param        limit       query  int     false  "Tamaño de página (por defecto 50, máximo 200)"
+// @Param        offset      query  int     false  "Posición desde la que se lista"
+// @Success      200  {object}  object{message=string,mode=string,data=[]models.RankingView,pagination=RankingPage}
 // @Router       /public/rankings [get]
 func (r *Repository) getRankings(context *fiber.Ctx) error {
 
-	rankings := []models.RankingView{}
+	mode, err := ranking.ParseMode(context.Query("mode"), r.Ranking.PlayerMode)
+	if err != nil {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "mode debe ser sum, max o best"})
+	}
+	n, err := strconv.Atoi(context.Query("n", "0"))
+	if err != nil || n < 0 {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "n inválido"})
+	}
+	counted := r.Ranking.VideosCounted(mode, n)
+
+	filter, err := parseRankingFilter(context)
+	if err != nil {
+		return context.Status(http.StatusBadRequest).JSON(&fiber.Map{"message": err.Error()})
+	}
+	where, args := filter.where()
 
-	err := r.DB.Find(&rankings).Error
+	// Requests with the same filters within the debounce window share the
+	// computed page
+	key := fmt.Sprintf("%s|%d|%s", mode, counted, filter.key())
+	rankings, err := r.PlayerRankings.Get(key, func() ([]models.RankingView, error) {
+		rankings := []models.RankingView{}
+
+		// Each player's videos are numbered best first; the score adds the
+		// votes of the first `counted` of them (all of them when 0)
+		args := append(args, counted, counted, filter.Limit, filter.Offset)
+		err := r.DB.Raw(`
+			WITH numbered AS (
+				SELECT
+					v.id,
+					v.title,
+					v.user_id,
+					v.vote_count,
+					ROW_NUMBER() OVER (PARTITION BY v.user_id ORDER BY v.vote_count DESC, v.id) AS position
+				FROM videos v
+				JOIN users u ON u.id = v.user_id
+				WHERE `+where+`
+			), scores AS (
+				SELECT user_id, SUM(vote_count) AS votes, COUNT(*) AS videos
+				FROM numbered
+				WHERE ? = 0 OR position <= ?
+				GROUP BY user_id
+			)
+			SELECT
+				u.id AS user_id,
+				u.handle,
+				u.display_name,
+				u.city,
+				s.votes,
+				s.videos,
+				b.id AS best_video_id,
+				b.title AS best_video_title,
+				RANK() OVER (ORDER BY s.votes DESC) AS rank,
+				COUNT(*) OVER () AS total
+			FROM scores s
+			JOIN users u ON u.id = s.user_id
+			JOIN numbered b ON b.user_id = s.user_id AND b.position = 1
+			ORDER BY rank, u.id
+			LIMIT ? OFFSET ?
+			`, args...).
+			Scan(&rankings).Error
+		return rankings, err
+	})
 
 	if err != nil {
+		log.Printf("Error computing player ranking: %v", err)
 		return context.Status(http.StatusInternalServerError).JSON(
 			&fiber.Map{"message": "Error al obtener los videos disponibles para votación"},
 		)
 	}
 
+	total := int64(0)
+	if len(rankings) > 0 {
+		total = rankings[0].Total
+	}
+
 	context.Status(http.StatusOK).JSON(&fiber.Map{
-		"message": "Se obtuvieron los rankings corretctamente",
-		"data":    rankings,
+		"message":    "Se obtuvieron los rankings corretctamente",
+		"mode":       mode,
+		"data":       rankings,
+		"pagination": filter.pagination(total),
 	})
 
 	return nil
 }
+
+// @Summary      Obtiene el ranking de videos
+// @Description  Videos procesados ordenados según strategy: raw (votos), trending (votos / (horas desde su publicación + 2)^gravedad, para que los videos recientes puedan superar a los antiguos) o bayesian ((votos + C·m) / (vistas + C), donde m es la tasa de votos por vista de todos los videos y C las vistas previas configuradas, para que pocos votos con pocas vistas no encabecen el ranking).
+// @Description  Sin strategy se usa la del concurso de contest_id y, si no tiene, la configurada. score es el puntaje con el que se ordena.
+// @Description  Los filtros se aplican antes de calcular las posiciones. Desempate: videos con el mismo puntaje comparten la posición (1, 1, 3) y se listan por id de video ascendente (el más antiguo primero).
+// @Tags         rankings
+// @Produce      json
+// @Param        strategy    query  string  false  "Orden del ranking (raw, trending, bayesian)"
+// @Param        city        query  string  false  "Ciudad del jugador"
+// @Param        country     query  string  false  "País del jugador"
+// @Param        contest_id  query  int     false  "Concurso del video"
+// @Param        user_type   query  string  false  "Tipo de usuario del jugador"
+// @Param        limit       query  int     false  "Tamaño de página (por defecto 50, máximo 200)"
+// @Param        offset      query  int     false  "Posición desde la que se lista"
+// @Success      200  {object}  object{message=string,strategy=string,data=[]models.VideoRanking,pagination=RankingPage}
+// @Router       /public/rankings/videos [get]
+func (r *Repository) getVideoRankings(context *fiber.Ctx) error {
+
+	filter, err := parseRankingFilter(context)
+	if err != nil {
+		return context.Status(http.StatusBadRequest).JSON(&fiber.Map{"message": err.Error()})
+	}
+	where, args := filter.where()
+
+	strategy, err := r.rankingStrategy(context.Query("strategy"), filter.ContestID)
+	if err != nil {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "strategy debe ser raw, trending o bayesian"})
+	}
+	score, scoreArgs := r.Ranking.Score(strategy)
+
+	rankings := []models.VideoRanking{}
+
+	args = append(append(scoreArgs, args...), filter.Limit, filter.Offset)
+	err = r.DB.Raw(`
+		WITH scored AS (
+			SELECT
+				v.id,
+				v.title,
+				v.vote_count,
+				v.view_count,
+				v.thumbnail_key,
+				u.id AS user_id,
+				u.handle,
+				u.display_name,
+				u.city,
+				`+score+` AS score
+			FROM videos v
+			JOIN users u ON u.id = v.user_id
+			WHERE `+where+`
+		)
+		SELECT
+			RANK() OVER (ORDER BY s.score DESC) AS rank,
+			COUNT(*) OVER () AS total,
+			s.id AS video_id,
+			s.title,
+			s.vote_count AS votes,
+			s.view_count AS views,
+			s.score,
+			s.thumbnail_key,
+			s.user_id,
+			s.handle,
+			s.display_name,
+			s.city
+		FROM scored s
+		ORDER BY rank, s.id
+		LIMIT ? OFFSET ?
+		`, args...).
+		Scan(&rankings).Error
+
+	if err != nil {
+		log.Printf("Error computing video ranking: %v", err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener el ranking de videos"},
+		)
+	}
+
+	ttl := playbackURLTTL()
+	for i := range rankings {
+		if rankings[i].ThumbnailKey == nil {
+			continue
+		}
+		url, err := r.Store.PresignGet(context.UserContext(), *rankings[i].ThumbnailKey, ttl)
+		if err != nil {
+			log.Printf("Error signing thumbnail URL: %v", err)
+			return context.Status(http.StatusInternalServerError).JSON(
+				&fiber.Map{"message": "Error al generar las URLs de reproducción"},
+			)
+		}
+		rankings[i].ThumbnailURL = &url
+	}
+
+	total := int64(0)
+	if len(rankings) > 0 {
+		total = rankings[0].Total
+	}
+
+	context.Status(http.StatusOK).JSON(&fiber.Map{
+		"message":    "Se obtuvo el ranking de videos correctamente",
+		"strategy":   strategy,
+		"data":       rankings,
+		"pagination": filter.pagination(total),
+	})
+
+	return nil
+}
+
+// rankingStrategy resolves the order of the video ranking: the one
+// requested, else the contest's, else the configured one. A contest with an
+// unknown strategy falls back to the configured one.
+func (r *Repository) rankingStrategy(requested string, contestID *uint) (ranking.Strategy, error) {
+	if requested != "" {
+		return ranking.ParseStrategy(requested, r.Ranking.Strategy)
+	}
+	if contestID == nil {
+		return r.Ranking.Strategy, nil
+	}
+
+	contest := models.Contest{}
+	if err := r.DB.Select("id", "ranking_strategy").Find(&contest, *contestID).Error; err != nil || contest.RankingStrategy == nil {
+		return r.Ranking.Strategy, nil
+	}
+	strategy, err := ranking.ParseStrategy(*contest.RankingStrategy, r.Ranking.Strategy)
+	if err != nil {
+		log.Printf("Contest %d has an invalid ranking strategy: %v", contest.ID, err)
+		return r.Ranking.Strategy, nil
+	}
+	return strategy, nil
+}
+
+// @Summary      Recibe en vivo los cambios del ranking de videos
+// @Description  Server-Sent Events. Al conectarse se envía un evento snapshot con las primeras posiciones, ordenadas según la estrategia configurada (score); luego, cada ráfaga de votos o reproducciones genera un evento update con los videos que cambiaron de posición o de votos (previousRank/previousVotes) y los que salieron (removed). Si el cliente se atrasa la conexión se cierra y debe reconectarse.
+// @Tags         rankings
+// @Produce      text/event-stream
+// @Success      200
+// @Router       /public/rankings/stream [get]
+func (r *Repository) streamRankings(context *fiber.Ctx) error {
+	if r.RankingStream == nil {
+		return context.Status(http.StatusServiceUnavailable).JSON(
+			&fiber.Map{"message": "Las actualizaciones en vivo no están disponibles"})
+	}
+
+	context.Set(fiber.HeaderContentType, "text/event-stream")
+	context.Set(fiber.HeaderCacheControl, "no-cache")
+	context.Set(fiber.HeaderConnection, "keep-alive")
+	context.Set("X-Accel-Buffering", "no")
+
+	standings, updates, cancel := r.RankingStream.Subscribe()
+
+	context.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		if err := writeEvent(w, "snapshot", standings); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, "update", update); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				// Comments keep proxies from closing the connection and
+				// detect clients that left
+				if _, err := w.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, event string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -1,16 +1,47 @@
 package repository
 
 import (
+	"back-end-todolist/backpressure"
+	"back-end-todolist/ingest"
+	"back-end-todolist/metrics"
 	"back-end-todolist/middlewares"
 	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"back-end-todolist/ranking"
+	"back-end-todolist/scan"
+	"back-end-todolist/storage"
+	"back-end-todolist/voting"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
+// Repository holds the dependencies of the handlers. The AWS clients are
+// built once at startup and shared by every request.
 type Repository struct {
-	DB *gorm.DB
+	DB           *gorm.DB
+	Store        *storage.ObjectStore
+	SQS          *sqs.Client
+	QueueURL     string
+	Metrics      *metrics.Collector
+	Backpressure *backpressure.Gate
+	Ingest       *ingest.Fetcher
+	Scanner      scan.Scanner
+	Quota        quota.Limits
+	Voting       voting.Rules
+	VotePolicy   voting.Policy
+	Ranking      ranking.Config
+
+	// Nil disables the live ranking endpoint
+	RankingStream *ranking.Stream
+	// Player rankings computed within the last debounce window; nil
+	// computes every request
+	PlayerRankings *ranking.Cache[[]models.RankingView]
 }
 
 type UserRequest struct {
@@ -22,8 +53,15 @@ type UserRequest struct {
 	City      *string `json:"city"`
 	Country   *string `json:"country"`
 	Type      *string `json:"type"`
+
+	// Identidad pública; sin handle se asigna uno por defecto
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
 }
 
+// Handles are lowercase letters, digits and underscores
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
 type LoginRequest struct {
 	Email    *string `json:"email"`
 	Password *string `json:"password"`
@@ -62,6 +100,28 @@ func (r *Repository) CreateUser(context *fiber.Ctx) error {
 			&fiber.Map{"message": "Ya existen perfiles con ese email"})
 	}
 
+	if user.Handle != nil && strings.TrimSpace(*user.Handle) == "" {
+		user.Handle = nil
+	}
+	if user.Handle != nil {
+		handle := strings.ToLower(strings.TrimSpace(*user.Handle))
+		if !handlePattern.MatchString(handle) {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "El handle debe tener entre 3 y 30 letras minúsculas, números o _"})
+		}
+
+		var taken int64
+		if err := r.DB.Model(&models.User{}).Where("handle = ?", handle).Count(&taken).Error; err != nil {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "No se puede validar usuario existente"})
+		}
+		if taken != 0 {
+			return context.Status(http.StatusConflict).JSON(
+				&fiber.Map{"message": "Ya existe un perfil con ese handle"})
+		}
+		user.Handle = &handle
+	}
+
 	if user.Password1 == nil || user.Password2 == nil {
 		return context.Status(http.StatusBadRequest).JSON(
 			fiber.Map{"message": "Debe enviar password1 y password2"})
@@ -89,17 +149,32 @@ func (r *Repository) CreateUser(context *fiber.Ctx) error {
 		userType = *user.Type
 	}
 
+	displayName := user.DisplayName
+	if displayName == nil || strings.TrimSpace(*displayName) == "" {
+		displayName = user.FirstName
+	}
+
 	userInsert := models.User{
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Password:  &hashedP,
-		City:      user.City,
-		Country:   user.Country,
-		Type:      &userType,
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Password:    &hashedP,
+		City:        user.City,
+		Country:     user.Country,
+		Type:        &userType,
+		Handle:      user.Handle,
+		DisplayName: displayName,
 	}
 
-	errCreate := r.DB.Create(&userInsert).Error
+	errCreate := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userInsert).Error; err != nil {
+			return err
+		}
+		if userInsert.Handle != nil {
+			return nil
+		}
+		return tx.Model(&userInsert).Update("handle", models.DefaultHandle(userInsert.ID)).Error
+	})
 
 	if errCreate != nil {
 		context.Status(http.StatusInternalServerError).JSON(
@@ -199,14 +274,37 @@ func (r *Repository) SetupRoutes(app *fiber.App) {
 	// Video routes
 	api.Post("/create_video", middlewares.AutValidation, r.UploadVideo)
 	api.Post("/create_video_test", middlewares.AutValidation, r.UploadVideoFromURL)
-	api.Get("/videos", middlewares.AutValidation, r.getMyVideos)              // Mis videos del usuario
-	api.Get("/videos/:video_id", middlewares.AutValidation, r.getVideoDetail) // Detalle de video específico
-	api.Delete("/videos/:video_id", middlewares.AutValidation, r.deleteVideo) // Eliminar video
+	api.Get("/videos", middlewares.AutValidation, r.getMyVideos)                          // Mis videos del usuario
+	api.Get("/videos/:video_id", middlewares.AutValidation, r.getVideoDetail)             // Detalle de video específico
+	api.Delete("/videos/:video_id", middlewares.AutValidation, r.deleteVideo)             // Eliminar video
+	api.Post("/uploads", middlewares.AutValidation, r.createUpload)                       // Carga directa a S3 (URL prefirmada)
+	api.Post("/uploads/:upload_id/complete", middlewares.AutValidation, r.completeUpload) // Verifica la carga y encola el video
+	api.Get("/me/quota", middlewares.AutValidation, r.getMyQuota)                         // Cuotas de carga restantes
+
+	// Resumable uploads (tus 1.0)
+	tus := api.Group("/uploads/tus", r.tusResumable)
+	tus.Options("", r.tusOptions)
+	tus.Post("", middlewares.AutValidation, r.createTusUpload)
+	tus.Head("/:upload_id", middlewares.AutValidation, r.getTusUploadOffset)
+	tus.Patch("/:upload_id", middlewares.AutValidation, r.patchTusUpload)
+	tus.Delete("/:upload_id", middlewares.AutValidation, r.deleteTusUpload)
+
 	api.Get("/public/videos", r.getAllVideos)
+	api.Post("/public/videos/:videoId/views", middlewares.AutValidation, middlewares.LimitPerUser(viewsPerMinute(), time.Minute), r.registerView)
 	api.Post("/public/videos/:videoId/vote", middlewares.AutValidation, r.voteForVideo)
+	api.Get("/public/videos/:videoId/vote", middlewares.AutValidation, r.getMyVote)
+	api.Delete("/public/videos/:videoId/vote", middlewares.AutValidation, r.retractVote)
 
 	// Ranking routes
 	api.Get("/public/rankings", r.getRankings)
+	api.Get("/public/rankings/videos", r.getVideoRankings)
+	api.Get("/public/rankings/stream", r.streamRankings)
+	api.Get("/public/rankings/videos/:videoId/history", r.getVideoRankHistory)
+	api.Get("/public/rankings/players/:userId/history", r.getPlayerRankHistory)
+	api.Get("/public/contests/:contestId/standings", r.getFinalStandings)
+
+	// Metrics routes
+	api.Get("/metrics/processing", r.getProcessingMetrics)
 
 	// Health check
 	api.Get("/health/check", r.HealthCheck)
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/scan"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errVideoRejected is returned with a video whose original failed the scan.
+// The video is stored as rejected and is not queued for processing.
+var errVideoRejected = errors.New("video rejected by the file scan")
+
+// scanOriginal runs the configured scanner over the stored original before
+// the video is queued. Infected or unscannable files are copied to
+// quarantine/ and the video is marked rejected with the reason; the returned
+// deletion removes the original from uploads/ and must be stored along with
+// the video.
+func (r *Repository) scanOriginal(ctx context.Context, video *models.Video) (*models.StorageDeletion, error) {
+	if _, noop := r.Scanner.(scan.Noop); r.Scanner == nil || noop || video.OriginalKey == nil {
+		return nil, nil
+	}
+
+	body, err := r.Store.Open(ctx, *video.OriginalKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreObject, err)
+	}
+	result, err := r.Scanner.Scan(ctx, body)
+	body.Close()
+
+	reason := ""
+	switch {
+	case err != nil:
+		log.Printf("Error scanning %s: %v", *video.OriginalKey, err)
+		reason = "The file could not be scanned"
+	case !result.Clean:
+		log.Printf("Threat %s found in %s", result.Signature, *video.OriginalKey)
+		reason = "Malicious content detected: " + result.Signature
+	default:
+		return nil, nil
+	}
+
+	originalKey := *video.OriginalKey
+	quarantineKey := "quarantine/" + strings.TrimPrefix(originalKey, "uploads/")
+	if err := r.Store.Copy(ctx, originalKey, quarantineKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreObject, err)
+	}
+
+	status := "rejected"
+	video.Status = &status
+	video.StatusReason = &reason
+	video.OriginalKey = &quarantineKey
+
+	return &models.StorageDeletion{
+		VideoID:       video.ID,
+		ObjectKey:     originalKey,
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// videoRejected writes the response for a video rejected by the file scan.
+func videoRejected(ctx *fiber.Ctx, video *models.Video) error {
+	return ctx.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{
+		"message": "Video rejected",
+		"reason":  video.StatusReason,
+		"video":   video,
+	})
+}
@@ -0,0 +1,647 @@
+package repository
+
+import (
+	"back-end-todolist/backpressure"
+	"back-end-todolist/models"
+	"back-end-todolist/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusUploadTTL  = 24 * time.Hour
+)
+
+// tusResumable validates the protocol version of every tus request and
+// advertises it on every response.
+func (r *Repository) tusResumable(context *fiber.Ctx) error {
+	context.Set("Tus-Resumable", tusVersion)
+
+	if context.Method() != fiber.MethodOptions && context.Get("Tus-Resumable") != tusVersion {
+		context.Set("Tus-Version", tusVersion)
+		return context.Status(http.StatusPreconditionFailed).JSON(
+			&fiber.Map{"message": "Versión de tus no soportada"})
+	}
+
+	return context.Next()
+}
+
+// @Summary      Capacidades del servidor tus
+// @Tags         uploads
+// @Success      204
+// @Router       /uploads/tus [options]
+func (r *Repository) tusOptions(context *fiber.Ctx) error {
+	context.Set("Tus-Version", tusVersion)
+	context.Set("Tus-Extension", tusExtensions)
+	context.Set("Tus-Max-Size", strconv.Itoa(maxUploadBytes))
+
+	return context.SendStatus(http.StatusNoContent)
+}
+
+// @Summary      Crea una carga reanudable (tus 1.0)
+// @Description  Requiere Upload-Length; Upload-Metadata admite filename, filetype, title y contest_id
+// @Tags         uploads
+// @Param        Upload-Length    header  int     true   "Tamaño total en bytes"
+// @Param        Upload-Metadata  header  string  false  "Metadatos tus (clave valor-base64)"
+// @Param        priority  query  string  false  "Prioridad de procesamiento (normal, low)"
+// @Success      201
+// @Failure      403 {string} string "Cuota de almacenamiento o de videos por concurso agotada"
+// @Failure      429 {string} string "Cuota diaria de cargas agotada, reintentar luego de Retry-After"
+// @Router       /uploads/tus [post]
+func (r *Repository) createTusUpload(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+
+	lowPriority := context.Query("priority") == "low"
+	decision, err := r.admitUpload(context, lowPriority)
+	if decision == backpressure.Reject {
+		return err
+	}
+
+	length, err := strconv.ParseInt(context.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "Upload-Length inválido"})
+	}
+	if length > maxUploadBytes {
+		return context.Status(http.StatusRequestEntityTooLarge).JSON(
+			&fiber.Map{"message": "El archivo supera el tamaño máximo permitido"})
+	}
+
+	metadata, err := parseTusMetadata(context.Get("Upload-Metadata"))
+	if err != nil {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "Upload-Metadata inválido"})
+	}
+
+	var contentType *string
+	if filetype, ok := metadata["filetype"]; ok {
+		if !strings.HasPrefix(filetype, "video/") {
+			return context.Status(http.StatusBadRequest).JSON(
+				&fiber.Map{"message": "filetype debe ser de tipo video"})
+		}
+		contentType = &filetype
+	}
+
+	var title *string
+	if t, ok := metadata["title"]; ok {
+		title = &t
+	}
+
+	contestID, ok := r.resolveContest(context, metadata["contest_id"])
+	if !ok {
+		return nil
+	}
+	if !r.precheckQuota(context, userID, contestID, length) {
+		return nil
+	}
+
+	ext := uploadExtension(metadata["filename"])
+
+	now := time.Now()
+	upload := models.Upload{
+		ID:           uuid.NewString(),
+		Protocol:     "tus",
+		Title:        title,
+		ContentType:  contentType,
+		DeclaredSize: length,
+		LowPriority:  lowPriority,
+		ContestID:    contestID,
+		Status:       "pending",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(tusUploadTTL),
+		UserID:       userID,
+	}
+	upload.ObjectKey = fmt.Sprintf("uploads/%d_%s%s", userID, upload.ID, ext)
+
+	// Each PATCH is sent as parts of this upload, so the chunks never go
+	// through the API again to be joined
+	multipartID, err := r.Store.CreateMultipart(context.UserContext(), upload.ObjectKey, aws.ToString(contentType))
+	if err != nil {
+		log.Println(err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "No se pudo registrar la carga"})
+	}
+	upload.MultipartID = &multipartID
+
+	if err := r.DB.Create(&upload).Error; err != nil {
+		r.Store.AbortMultipart(context.UserContext(), upload.ObjectKey, multipartID)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "No se pudo registrar la carga"})
+	}
+
+	context.Set(fiber.HeaderLocation, context.BaseURL()+"/api/uploads/tus/"+upload.ID)
+	context.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	return context.SendStatus(http.StatusCreated)
+}
+
+// @Summary      Consulta el avance de una carga reanudable
+// @Tags         uploads
+// @Param        upload_id   path      string  true  "ID de la carga"
+// @Success      200
+// @Router       /uploads/tus/{upload_id} [head]
+func (r *Repository) getTusUploadOffset(context *fiber.Ctx) error {
+	context.Set(fiber.HeaderCacheControl, "no-store")
+
+	upload, status := r.findTusUpload(context)
+	if upload == nil {
+		return context.SendStatus(status)
+	}
+
+	context.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	context.Set("Upload-Length", strconv.FormatInt(upload.DeclaredSize, 10))
+	context.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	return context.SendStatus(http.StatusOK)
+}
+
+// @Summary      Envía un fragmento de una carga reanudable
+// @Description  El cuerpo (application/offset+octet-stream) se agrega en Upload-Offset y se envía a S3 como partes de una carga multiparte; al recibir el último fragmento se completa la carga, se crea el video y se encola su procesamiento
+// @Tags         uploads
+// @Param        upload_id      path    string  true  "ID de la carga"
+// @Param        Upload-Offset  header  int     true  "Posición del fragmento"
+// @Success      204
+// @Router       /uploads/tus/{upload_id} [patch]
+func (r *Repository) patchTusUpload(context *fiber.Ctx) error {
+	if context.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return context.Status(http.StatusUnsupportedMediaType).JSON(
+			&fiber.Map{"message": "Content-Type debe ser application/offset+octet-stream"})
+	}
+
+	offset, err := strconv.ParseInt(context.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "Upload-Offset inválido"})
+	}
+
+	upload, status := r.findTusUpload(context)
+	if upload == nil {
+		return context.SendStatus(status)
+	}
+
+	if offset != upload.Offset {
+		return context.Status(http.StatusConflict).JSON(&fiber.Map{
+			"message": "Upload-Offset no coincide con el avance de la carga",
+		})
+	}
+
+	store := r.Store
+
+	remaining := upload.DeclaredSize - upload.Offset
+	body := r.requestBody(context)
+
+	progress, err := r.writeTusParts(context.UserContext(), store, upload, io.LimitReader(body, remaining))
+	if err != nil {
+		log.Println(err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error guardando el fragmento"})
+	}
+
+	// Bytes past the remaining length make the whole chunk invalid
+	if progress.Received == remaining {
+		if n, _ := io.ReadFull(body, make([]byte, 1)); n > 0 {
+			progress.discard(context.UserContext(), store)
+			return context.Status(http.StatusRequestEntityTooLarge).JSON(
+				&fiber.Map{"message": "El fragmento excede Upload-Length"})
+		}
+	}
+
+	if progress.Received > 0 {
+		if err := r.commitTusProgress(upload, progress); err != nil {
+			progress.discard(context.UserContext(), store)
+			return context.Status(http.StatusConflict).JSON(
+				&fiber.Map{"message": "Upload-Offset no coincide con el avance de la carga"})
+		}
+		progress.release(context.UserContext(), store)
+	} else {
+		progress.discard(context.UserContext(), store)
+	}
+
+	context.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	context.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	if upload.Offset < upload.DeclaredSize {
+		return context.SendStatus(http.StatusNoContent)
+	}
+
+	// A rejected video still completes the upload; its status and reason
+	// are available through the video
+	video, err := r.finishTusUpload(context.UserContext(), store, upload)
+	if err != nil && !errors.Is(err, errVideoRejected) {
+		return videoCreationFailed(context, err)
+	}
+
+	context.Set("Upload-Video-Id", strconv.FormatUint(uint64(video.ID), 10))
+	return context.SendStatus(http.StatusNoContent)
+}
+
+// @Summary      Cancela una carga reanudable
+// @Tags         uploads
+// @Param        upload_id   path      string  true  "ID de la carga"
+// @Success      204
+// @Router       /uploads/tus/{upload_id} [delete]
+func (r *Repository) deleteTusUpload(context *fiber.Ctx) error {
+	upload, status := r.findTusUpload(context)
+	if upload == nil {
+		return context.SendStatus(status)
+	}
+
+	store := r.Store
+
+	if err := r.discardUpload(context.UserContext(), store, upload, "terminated"); err != nil {
+		log.Println(err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error eliminando la carga"})
+	}
+
+	return context.SendStatus(http.StatusNoContent)
+}
+
+// findTusUpload loads the pending tus upload of the authenticated user. When
+// it cannot be used it returns nil and the status to respond with.
+func (r *Repository) findTusUpload(context *fiber.Ctx) (*models.Upload, int) {
+	userID := context.Locals("userID").(uint)
+	uploadID := context.Params("upload_id")
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, http.StatusNotFound
+	}
+
+	upload := models.Upload{}
+	err := r.DB.Where("id = ? AND user_id = ? AND protocol = ?", uploadID, userID, "tus").First(&upload).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, http.StatusNotFound
+		}
+		return nil, http.StatusInternalServerError
+	}
+
+	if upload.Status != "pending" || time.Now().After(upload.ExpiresAt) {
+		return nil, http.StatusGone
+	}
+
+	return &upload, http.StatusOK
+}
+
+// tusProgress is what a PATCH added to a tus upload. It is committed at once,
+// so a request that fails leaves the upload as it was.
+type tusProgress struct {
+	// Bytes read from the request
+	Received int64
+	// Parts sent to the multipart upload, and bytes left for the next part
+	Parts     []models.UploadPart
+	Tail      *models.UploadChunk
+	HashState []byte
+
+	// Bytes left by the previous request, sent with these parts
+	consumed *models.UploadChunk
+}
+
+// writeTusParts sends the bytes of a PATCH to the multipart upload of the
+// tus upload in parts of storage.MinPartSize. Bytes left from the previous
+// request go first; whatever remains below the part size, unless it ends the
+// upload, is stored for the next request. Only those few bytes are ever read
+// back through the API.
+func (r *Repository) writeTusParts(ctx context.Context, store *storage.ObjectStore, upload *models.Upload, body io.Reader) (*tusProgress, error) {
+	progress := &tusProgress{}
+
+	hasher := sha256.New()
+	if len(upload.HashState) > 0 {
+		if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+			return nil, fmt.Errorf("error restoring the checksum of upload %s: %w", upload.ID, err)
+		}
+	}
+
+	tail := []models.UploadChunk{}
+	if err := r.DB.Where("upload_id = ?", upload.ID).Limit(1).Find(&tail).Error; err != nil {
+		return nil, err
+	}
+	partNumber := int64(0)
+	if err := r.DB.Model(&models.UploadPart{}).Where("upload_id = ?", upload.ID).Count(&partNumber).Error; err != nil {
+		return nil, err
+	}
+
+	received := &countingReader{r: io.TeeReader(body, hasher)}
+	reader := io.Reader(received)
+	offset := upload.Offset
+	if len(tail) > 0 {
+		previous, err := store.Open(ctx, tail[0].ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+		defer previous.Close()
+		progress.consumed = &tail[0]
+		reader = io.MultiReader(previous, received)
+		offset -= tail[0].Size
+	}
+
+	buffer := make([]byte, storage.MinPartSize)
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			progress.discard(ctx, store)
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+
+		if n < len(buffer) && offset+int64(n) < upload.DeclaredSize {
+			key := fmt.Sprintf("tus/%s/%012d-%s", upload.ID, offset, uuid.NewString()[:8])
+			if err := store.Upload(ctx, key, bytes.NewReader(buffer[:n]), ""); err != nil {
+				progress.discard(ctx, store)
+				return nil, err
+			}
+			progress.Tail = &models.UploadChunk{UploadID: upload.ID, Offset: offset, Size: int64(n), ObjectKey: key}
+			break
+		}
+
+		partNumber++
+		etag, err := store.UploadPart(ctx, upload.ObjectKey, aws.ToString(upload.MultipartID), int32(partNumber), buffer[:n])
+		if err != nil {
+			progress.discard(ctx, store)
+			return nil, err
+		}
+		progress.Parts = append(progress.Parts, models.UploadPart{
+			UploadID:   upload.ID,
+			PartNumber: int32(partNumber),
+			Offset:     offset,
+			Size:       int64(n),
+			ETag:       etag,
+		})
+		offset += int64(n)
+
+		if n < len(buffer) {
+			break
+		}
+	}
+
+	state, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		progress.discard(ctx, store)
+		return nil, err
+	}
+	progress.Received = received.n
+	progress.HashState = state
+	return progress, nil
+}
+
+// discard deletes what a request stored but did not commit. Uncommitted
+// parts are replaced by the next request, which reuses their numbers.
+func (p *tusProgress) discard(ctx context.Context, store *storage.ObjectStore) {
+	if p.Tail != nil {
+		if err := store.Delete(ctx, p.Tail.ObjectKey); err != nil {
+			log.Printf("Error deleting tus chunk %s: %v", p.Tail.ObjectKey, err)
+		}
+	}
+}
+
+// release deletes the bytes left by the previous request once they were
+// committed as part of this one.
+func (p *tusProgress) release(ctx context.Context, store *storage.ObjectStore) {
+	if p.consumed == nil {
+		return
+	}
+	if err := store.Delete(ctx, p.consumed.ObjectKey); err != nil {
+		log.Printf("Error deleting tus chunk %s: %v", p.consumed.ObjectKey, err)
+	}
+}
+
+// commitTusProgress records the parts and chunk of a request and advances the
+// offset, failing if another request moved the offset in the meantime.
+func (r *Repository) commitTusProgress(upload *models.Upload, progress *tusProgress) error {
+	expiresAt := time.Now().Add(tusUploadTTL)
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"upload_offset": gorm.Expr("upload_offset + ?", progress.Received),
+			"hash_state":    progress.HashState,
+			"expires_at":    expiresAt,
+		}
+		result := tx.Model(&models.Upload{}).
+			Where("id = ? AND status = ? AND upload_offset = ?", upload.ID, "pending", upload.Offset).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("upload %s offset changed", upload.ID)
+		}
+
+		if err := tx.Where("upload_id = ?", upload.ID).Delete(&models.UploadChunk{}).Error; err != nil {
+			return err
+		}
+		if len(progress.Parts) > 0 {
+			if err := tx.Create(&progress.Parts).Error; err != nil {
+				return err
+			}
+		}
+		if progress.Tail != nil {
+			if err := tx.Create(progress.Tail).Error; err != nil {
+				return err
+			}
+		}
+
+		upload.Offset += progress.Received
+		upload.HashState = progress.HashState
+		upload.ExpiresAt = expiresAt
+		return nil
+	})
+}
+
+// finishTusUpload completes the multipart upload into the original object and
+// feeds it to the same video creation path as the other uploads. When the
+// user already uploaded the same content, the upload completes with their
+// existing video.
+func (r *Repository) finishTusUpload(ctx context.Context, store *storage.ObjectStore, upload *models.Upload) (*models.Video, error) {
+	claim := r.DB.Model(&models.Upload{}).
+		Where("id = ? AND status = ?", upload.ID, "pending").
+		Updates(map[string]interface{}{"status": "completing", "claimed_at": time.Now()})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: upload %s is not pending", errStoreVideo, upload.ID)
+	}
+
+	video, err := r.assembleTusUpload(ctx, store, upload)
+	if video == nil || video.ID == 0 {
+		r.releaseUpload(ctx, upload, video, err)
+		return nil, err
+	}
+
+	r.DB.Model(upload).Updates(map[string]interface{}{
+		"status":   "completed",
+		"video_id": video.ID,
+	})
+	if err := r.DB.Where("upload_id = ?", upload.ID).Delete(&models.UploadPart{}).Error; err != nil {
+		log.Printf("Error deleting parts of upload %s: %v", upload.ID, err)
+	}
+
+	return video, err
+}
+
+func (r *Repository) assembleTusUpload(ctx context.Context, store *storage.ObjectStore, upload *models.Upload) (*models.Video, error) {
+	parts := []models.UploadPart{}
+	if err := r.DB.Where("upload_id = ?", upload.ID).Order("part_number").Find(&parts).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	if err := store.CompleteMultipart(ctx, upload.ObjectKey, aws.ToString(upload.MultipartID), completed); err != nil {
+		// An earlier attempt may have completed it and failed afterwards
+		head, headErr := store.Head(ctx, upload.ObjectKey)
+		if headErr != nil || aws.ToInt64(head.ContentLength) != upload.DeclaredSize {
+			return nil, fmt.Errorf("%w: %v", errStoreObject, err)
+		}
+	}
+
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	// Recorded so an interrupted completion can find the video by content
+	sum := hasher.Sum(nil)
+	checksum := base64.StdEncoding.EncodeToString(sum)
+	if err := r.DB.Model(upload).Update("checksum_sha256", checksum).Error; err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreVideo, err)
+	}
+
+	title := ""
+	if upload.Title != nil {
+		title = *upload.Title
+	}
+	size := upload.DeclaredSize
+	video := models.Video{
+		UserID:    upload.UserID,
+		Title:     &title,
+		SizeBytes: &size,
+		ContestID: upload.ContestID,
+	}
+
+	existing, err := r.storeOriginal(ctx, store, &video, upload.ObjectKey, hex.EncodeToString(sum))
+	if errors.Is(err, errDuplicateVideo) {
+		return existing, nil
+	}
+	if err != nil {
+		return &video, err
+	}
+
+	_, err = r.createVideo(ctx, &video, r.storedUploadDecision(ctx, upload.LowPriority))
+	if errors.Is(err, errDuplicateVideo) {
+		return &video, nil
+	}
+	return &video, err
+}
+
+// discardUpload deletes everything stored for an unfinished upload and
+// leaves it in the given final status.
+func (r *Repository) discardUpload(ctx context.Context, store *storage.ObjectStore, upload *models.Upload, status string) error {
+	if err := r.discardChunks(ctx, store, upload); err != nil {
+		return err
+	}
+	if upload.MultipartID != nil {
+		if err := store.AbortMultipart(ctx, upload.ObjectKey, *upload.MultipartID); err != nil {
+			return err
+		}
+		if err := r.DB.Where("upload_id = ?", upload.ID).Delete(&models.UploadPart{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := store.Delete(ctx, upload.ObjectKey); err != nil {
+		return err
+	}
+
+	return r.DB.Model(upload).Update("status", status).Error
+}
+
+func (r *Repository) discardChunks(ctx context.Context, store *storage.ObjectStore, upload *models.Upload) error {
+	chunks := []models.UploadChunk{}
+	if err := r.DB.Where("upload_id = ?", upload.ID).Find(&chunks).Error; err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		keys = append(keys, chunk.ObjectKey)
+	}
+	if err := store.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	return r.DB.Where("upload_id = ?", upload.ID).Delete(&models.UploadChunk{}).Error
+}
+
+// requestBody returns the request body without buffering it when fiber is
+// streaming request bodies.
+func (r *Repository) requestBody(context *fiber.Ctx) io.Reader {
+	if stream := context.Request().BodyStream(); stream != nil {
+		return stream
+	}
+	return bytes.NewReader(context.Body())
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated pairs
+// of a key and an optional base64 value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", parts[0], err)
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid metadata pair %q", pair)
+		}
+	}
+
+	return metadata, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"back-end-todolist/backpressure"
+	"back-end-todolist/models"
+	"back-end-todolist/quota"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Same limit the API applies to multipart uploads (fiber BodyLimit)
+	maxUploadBytes = 100 * 1024 * 1024
+	uploadURLTTL   = 15 * time.Minute
+
+	// An upload still completing after this long was interrupted
+	completingTimeout = 15 * time.Minute
+)
+
+type UploadRequest struct {
+	Title          *string `json:"title"`
+	Filename       *string `json:"filename"`
+	ContentType    *string `json:"content_type"`
+	Size           int64   `json:"size"`
+	ChecksumSHA256 *string `json:"checksum_sha256"`
+	ContestID      *uint   `json:"contest_id"`
+}
+
+// Extensions kept in the object key of an upload; any other file name is
+// stored as .mp4
+var videoExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true, ".avi": true,
+}
+
+// uploadExtension returns the extension of the object key for an uploaded
+// file name. Only known video extensions are kept, so the name cannot put
+// arbitrary characters in the key.
+func uploadExtension(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !videoExtensions[ext] {
+		return ".mp4"
+	}
+	return ext
+}
+
+// @Summary      Inicia una carga directa a almacenamiento
+// @Description  Devuelve una URL prefirmada (PUT) para subir el video directamente a S3 y el id de la carga
+// @Tags         uploads
+// @Accept       json
+// @Produce      json
+// @Param        upload  body  UploadRequest true  "Datos del archivo a subir (size en bytes, checksum_sha256 obligatorio en base64)"
+// @Param        priority  query  string  false  "Prioridad de procesamiento (normal, low)"
+// @Success      201 {object}  models.Upload
+// @Failure      400 {string} string "Datos del archivo inválidos o sin checksum_sha256"
+// @Failure      403 {string} string "Cuota de almacenamiento o de videos por concurso agotada"
+// @Failure      429 {string} string "Cuota diaria de cargas agotada, reintentar luego de Retry-After"
+// @Failure      503 {string} string "Cola de procesamiento saturada, reintentar luego de Retry-After"
+// @Router       /uploads [post]
+func (r *Repository) createUpload(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+
+	lowPriority := context.Query("priority") == "low"
+	decision, err := r.admitUpload(context, lowPriority)
+	if decision == backpressure.Reject {
+		return err
+	}
+
+	request := UploadRequest{}
+	if err := context.BodyParser(&request); err != nil {
+		return context.Status(http.StatusUnprocessableEntity).JSON(
+			&fiber.Map{"message": "Datos inválidos"})
+	}
+
+	if request.Size <= 0 || request.Size > maxUploadBytes {
+		return context.Status(http.StatusBadRequest).JSON(&fiber.Map{
+			"message": fmt.Sprintf("size debe estar entre 1 y %d bytes", maxUploadBytes),
+		})
+	}
+
+	if request.ContentType != nil && !strings.HasPrefix(*request.ContentType, "video/") {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "content_type debe ser de tipo video"})
+	}
+
+	// The checksum is the content address of the original, and S3 rejects
+	// a PUT whose bytes do not match it
+	if request.ChecksumSHA256 == nil {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "checksum_sha256 es obligatorio"})
+	}
+	checksum := *request.ChecksumSHA256
+	if sum, err := base64.StdEncoding.DecodeString(checksum); err != nil || len(sum) != 32 {
+		return context.Status(http.StatusBadRequest).JSON(
+			&fiber.Map{"message": "checksum_sha256 debe ser un SHA-256 en base64"})
+	}
+
+	rawContest := ""
+	if request.ContestID != nil {
+		rawContest = strconv.FormatUint(uint64(*request.ContestID), 10)
+	}
+	contestID, ok := r.resolveContest(context, rawContest)
+	if !ok {
+		return nil
+	}
+	if !r.precheckQuota(context, userID, contestID, request.Size) {
+		return nil
+	}
+
+	filename := ""
+	if request.Filename != nil {
+		filename = *request.Filename
+	}
+	ext := uploadExtension(filename)
+
+	uploadID := uuid.NewString()
+	objectKey := fmt.Sprintf("uploads/%d_%s%s", userID, uploadID, ext)
+
+	contentType := ""
+	if request.ContentType != nil {
+		contentType = *request.ContentType
+	}
+
+	store := r.Store
+
+	presigned, err := store.PresignPut(context.UserContext(), objectKey, contentType, request.Size, checksum, uploadURLTTL)
+	if err != nil {
+		log.Println(err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "No se pudo generar la URL de carga"})
+	}
+
+	now := time.Now()
+	upload := models.Upload{
+		ID:             uploadID,
+		Title:          request.Title,
+		ObjectKey:      objectKey,
+		ContentType:    request.ContentType,
+		DeclaredSize:   request.Size,
+		ChecksumSHA256: request.ChecksumSHA256,
+		LowPriority:    lowPriority,
+		ContestID:      contestID,
+		Status:         "pending",
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(uploadURLTTL),
+		UserID:         userID,
+	}
+
+	if err := r.DB.Create(&upload).Error; err != nil {
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "No se pudo registrar la carga"})
+	}
+
+	return context.Status(http.StatusCreated).JSON(&fiber.Map{
+		"message":    "Carga iniciada, suba el archivo a la URL indicada",
+		"upload_id":  upload.ID,
+		"upload":     presigned,
+		"expires_at": upload.ExpiresAt,
+	})
+}
+
+// @Summary      Completa una carga directa a almacenamiento
+// @Description  Verifica que el objeto exista con el tamaño y checksum declarados, crea el video y encola su procesamiento
+// @Tags         uploads
+// @Produce      json
+// @Param        upload_id   path      string  true  "ID de la carga"
+// @Success      200 {object}  models.Video
+// @Failure      403 {string} string "Cuota de almacenamiento o de videos por concurso agotada"
+// @Failure      429 {string} string "Cuota diaria de cargas agotada, reintentar luego de Retry-After"
+// @Router       /uploads/{upload_id}/complete [post]
+func (r *Repository) completeUpload(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+	uploadID := context.Params("upload_id")
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "upload_id inválido")
+	}
+
+	upload := models.Upload{}
+	if err := r.DB.Where("id = ? AND user_id = ?", uploadID, userID).First(&upload).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return context.Status(http.StatusNotFound).JSON(
+				&fiber.Map{"message": "Carga no encontrada"})
+		}
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al obtener la carga"})
+	}
+
+	if upload.Status == "completed" {
+		return context.Status(http.StatusConflict).JSON(&fiber.Map{
+			"message":  "La carga ya fue completada",
+			"video_id": upload.VideoID,
+		})
+	}
+
+	if upload.Status == "pending" && time.Now().After(upload.ExpiresAt) {
+		return context.Status(http.StatusGone).JSON(
+			&fiber.Map{"message": "La URL de carga expiró, inicie una nueva carga"})
+	}
+
+	// Claim the upload so concurrent calls cannot create the video twice
+	claim := r.DB.Model(&models.Upload{}).
+		Where("id = ? AND status = ?", upload.ID, "pending").
+		Updates(map[string]interface{}{"status": "completing", "claimed_at": time.Now()})
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return context.Status(http.StatusConflict).JSON(
+			&fiber.Map{"message": "La carga no está pendiente"})
+	}
+
+	video, taskID, err := r.finishUpload(context, &upload)
+
+	if video.ID == 0 {
+		r.releaseUpload(context.UserContext(), &upload, video, err)
+	} else {
+		r.DB.Model(&upload).Updates(map[string]interface{}{
+			"status":   "completed",
+			"video_id": video.ID,
+		})
+	}
+
+	if errors.Is(err, errDuplicateVideo) {
+		return context.JSON(fiber.Map{
+			"message":   "Duplicate upload, returning existing video",
+			"video":     video,
+			"duplicate": true,
+		})
+	}
+
+	if errors.Is(err, errVideoRejected) {
+		return videoRejected(context, video)
+	}
+
+	if err != nil {
+		var verifyErr *fiber.Error
+		if errors.As(err, &verifyErr) {
+			return context.Status(verifyErr.Code).JSON(&fiber.Map{"message": verifyErr.Message})
+		}
+		return videoCreationFailed(context, err)
+	}
+
+	return context.JSON(fiber.Map{
+		"message": "Stored video. Processing scheduled.",
+		"video":   video,
+		"task_id": taskID,
+	})
+}
+
+// releaseUpload ends the claim of an upload whose video was not stored. If
+// the original is still at the upload's key the upload goes back to pending
+// so it can be completed again. Once storeOriginal moved it to its content
+// key the upload cannot be completed any more: it fails, and the moved
+// original is queued for deletion unless createVideo already did it.
+func (r *Repository) releaseUpload(ctx context.Context, upload *models.Upload, video *models.Video, err error) {
+	if video == nil || video.OriginalKey == nil || *video.OriginalKey == upload.ObjectKey {
+		r.DB.Model(upload).Update("status", "pending")
+		return
+	}
+
+	var exceeded *quota.Exceeded
+	if !errors.As(err, &exceeded) {
+		r.dropOriginal(ctx, video)
+	}
+	r.DB.Model(upload).Update("status", "failed")
+}
+
+// finishUpload verifies the uploaded object and creates its video. The video
+// has an ID only if its record was stored; verification failures are
+// returned as *fiber.Error with the status to respond with. The object is
+// moved to its content-addressed key, and an earlier video of the user with
+// the same content is returned with errDuplicateVideo.
+func (r *Repository) finishUpload(context *fiber.Ctx, upload *models.Upload) (*models.Video, *string, error) {
+	video := &models.Video{}
+
+	store := r.Store
+
+	head, err := store.Head(context.UserContext(), upload.ObjectKey)
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return video, nil, fiber.NewError(http.StatusConflict, "El archivo aún no ha sido subido")
+		}
+		log.Printf("Error reading uploaded object %s: %v", upload.ObjectKey, err)
+		return video, nil, fiber.NewError(http.StatusInternalServerError, "Error verificando el archivo subido")
+	}
+
+	if head.ContentLength == nil || *head.ContentLength != upload.DeclaredSize {
+		return video, nil, fiber.NewError(http.StatusUnprocessableEntity, "El tamaño del archivo no coincide con el declarado")
+	}
+
+	if head.ChecksumSHA256 == nil || *head.ChecksumSHA256 != aws.ToString(upload.ChecksumSHA256) {
+		return video, nil, fiber.NewError(http.StatusUnprocessableEntity, "El checksum del archivo no coincide con el declarado")
+	}
+
+	title := ""
+	if upload.Title != nil {
+		title = *upload.Title
+	}
+	objectKey := upload.ObjectKey
+	size := upload.DeclaredSize
+	video.UserID = upload.UserID
+	video.Title = &title
+	video.OriginalKey = &objectKey
+	video.SizeBytes = &size
+	video.ContestID = upload.ContestID
+
+	sum, _ := base64.StdEncoding.DecodeString(*upload.ChecksumSHA256)
+	existing, err := r.storeOriginal(context.UserContext(), store, video, upload.ObjectKey, hex.EncodeToString(sum))
+	if errors.Is(err, errDuplicateVideo) {
+		signVideoURLs(context.UserContext(), store, true, existing)
+		return existing, nil, err
+	}
+	if err != nil {
+		return video, nil, err
+	}
+
+	taskID, err := r.createVideo(context.UserContext(), video, r.storedUploadDecision(context.UserContext(), upload.LowPriority))
+	if err == nil || errors.Is(err, errDuplicateVideo) {
+		signVideoURLs(context.UserContext(), store, true, video)
+	}
+	return video, taskID, err
+}
+
+// ExpireUploads discards the uploads that were not completed before they
+// expired, removing their chunks and partial objects from storage, and trims
+// the upload log to the daily window. Uploads
+// left completing by an interrupted request are closed too: completed if
+// their video was stored, discarded otherwise.
+func (r *Repository) ExpireUploads(ctx context.Context) error {
+	now := time.Now()
+
+	if err := r.DB.WithContext(ctx).
+		Where("created_at < ?", now.Add(-uploadEventsKept)).
+		Delete(&models.UploadEvent{}).Error; err != nil {
+		return err
+	}
+	uploads := []models.Upload{}
+	if err := r.DB.
+		Where("status = ? AND expires_at < ?", "pending", now).
+		Or("status = ? AND COALESCE(claimed_at, created_at) < ?", "completing", now.Add(-completingTimeout)).
+		Limit(100).
+		Find(&uploads).Error; err != nil {
+		return err
+	}
+	if len(uploads) == 0 {
+		return nil
+	}
+
+	store := r.Store
+
+	for i := range uploads {
+		upload := &uploads[i]
+		if upload.Status == "completing" {
+			video, err := r.uploadedVideo(ctx, upload)
+			if err != nil {
+				log.Printf("Error looking up the video of upload %s: %v", upload.ID, err)
+				continue
+			}
+			if video != nil {
+				if err := r.DB.Model(upload).Updates(map[string]interface{}{
+					"status":   "completed",
+					"video_id": video.ID,
+				}).Error; err != nil {
+					log.Printf("Error completing upload %s: %v", upload.ID, err)
+				}
+				continue
+			}
+		}
+		if err := r.discardUpload(ctx, store, upload, "expired"); err != nil {
+			log.Printf("Error expiring upload %s: %v", upload.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// uploadedVideo returns the video created from upload, or nil if none was
+// stored. Videos are found by content; a tus upload without a checksum yet
+// never got to store one.
+func (r *Repository) uploadedVideo(ctx context.Context, upload *models.Upload) (*models.Video, error) {
+	if upload.ChecksumSHA256 == nil {
+		return nil, nil
+	}
+	sum, _ := base64.StdEncoding.DecodeString(*upload.ChecksumSHA256)
+
+	video := models.Video{}
+	err := r.DB.WithContext(ctx).
+		Where("user_id = ? AND checksum_sha256 = ?", upload.UserID, hex.EncodeToString(sum)).
+		First(&video).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
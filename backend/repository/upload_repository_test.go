@@ -0,0 +1,24 @@
+package repository
+
+import "testing"
+
+func TestUploadExtension(t *testing.T) {
+	cases := []struct {
+		filename, want string
+	}{
+		{"clip.mp4", ".mp4"},
+		{"Clip.MOV", ".mov"},
+		{"clip.webm", ".webm"},
+		{"", ".mp4"},
+		{"clip", ".mp4"},
+		{"x.mp4?a#b", ".mp4"},
+		{"clip.exe", ".mp4"},
+		{"../../clip.mkv/..", ".mp4"},
+	}
+
+	for _, c := range cases {
+		if got := uploadExtension(c.filename); got != c.want {
+			t.Errorf("uploadExtension(%q) = %q, want %q", c.filename, got, c.want)
+		}
+	}
+}
@@ -1,312 +1,113 @@
 package repository
 
 import (
+	"back-end-todolist/backpressure"
 	"back-end-todolist/models"
-	"context"
-	"fmt"
-	"io"
+	"back-end-todolist/ranking"
+	"errors"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
-	"strings"
-	"time"
 
-	"encoding/json"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // @Summary      Carga un video en el sistema
-// @Description  Un usuario tipo player autenticado, puede subir un video
+// @Description  Un usuario tipo player autenticado, puede subir un video. Si ya subió el mismo contenido se devuelve su video existente (duplicate: true)
 // @Tags         videos
 // @Produce      json
 // @Param        video  body  models.Video true  "Datos del video"
+// @Param        priority  query  string  false  "Prioridad de procesamiento (normal, low)"
+// @Param        contest_id  query  int  false  "Concurso al que se inscribe el video"
 // @Success      200 {array}  models.Video
+// @Failure      403 {string} string "Cuota de almacenamiento o de videos por concurso agotada"
+// @Failure      422 {string} string "Archivo rechazado por el análisis antivirus"
+// @Failure      429 {string} string "Cuota diaria de cargas agotada, reintentar luego de Retry-After"
+// @Failure      503 {string} string "Cola de procesamiento saturada, reintentar luego de Retry-After"
 // @Router       /create_video [post]
 func (r *Repository) UploadVideo(ctx *fiber.Ctx) error {
 	userID := ctx.Locals("userID").(uint)
 
-	// Get form-data video
-	title := ctx.FormValue("title")
-	file, err := ctx.FormFile("video_file")
-	if err != nil {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing video file",
-		})
-	}
-
-	// Sanitize filename (remove spaces and keep extension)
-	ext := filepath.Ext(file.Filename)
-	name := strings.TrimSuffix(file.Filename, ext)
-	safeName := strings.ReplaceAll(name, " ", "_")
-	finalFilename := fmt.Sprintf("%d_%s%s", userID, safeName, ext)
-
-	// Create temporary local file
-	tempPath := filepath.Join(os.TempDir(), finalFilename)
-	if err := ctx.SaveFile(file, tempPath); err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error saving video temporarily",
-		})
-	}
-	defer os.Remove(tempPath)
-
-	// --- Upload to S3 ---
-	bucketName := os.Getenv("S3_BUCKET")
-	region := os.Getenv("AWS_REGION")
-
-	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error loading AWS config",
-		})
-	}
-
-	client := s3.NewFromConfig(cfg)
-
-	// Open file for reading
-	f, err := os.Open(tempPath)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error opening temp file",
-		})
-	}
-	defer f.Close()
-
-	objectKey := fmt.Sprintf("uploads/%s", finalFilename)
-
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &objectKey,
-		Body:   f,
-	})
-	if err != nil {
-		wrappedErr := fmt.Errorf("error uploading to S3: %w", err)
-		fmt.Println(wrappedErr)
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error uploading to S3",
-		})
-	}
-
-	publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, region, objectKey)
-
-	// --- Store video record in DB ---
-	status := "uploaded"
-	now := time.Now()
-	video := models.Video{
-		UserID:      userID,
-		Title:       &title,
-		OriginalURL: &publicURL,
-		Status:      &status,
-		UploadedAt:  &now,
+	// Check the processing backlog before reading the body
+	decision, err := r.admitUpload(ctx, ctx.Query("priority") == "low")
+	if decision == backpressure.Reject {
+		return err
 	}
 
-	if err := r.DB.Create(&video).Error; err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error storing in DB",
-		})
+	// The contest comes in the query string so quotas are checked before
+	// the body is streamed
+	contestID, ok := r.resolveContest(ctx, ctx.Query("contest_id"))
+	if !ok {
+		return nil
 	}
-
-	// Enqueue task
-	queueURL := os.Getenv("SQS_QUEUE_URL")
-
-	cfg, err = config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error loading AWS config",
-		})
+	if !r.precheckQuota(ctx, userID, contestID, 0) {
+		return nil
 	}
-	sqsClient := sqs.NewFromConfig(cfg)
 
-	payload := map[string]interface{}{
-		"video_id": video.ID,
-	}
-	body, _ := json.Marshal(payload)
+	store := r.Store
 
-	resp, err := sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
-		QueueUrl:    &queueURL,
-		MessageBody: aws.String(string(body)),
-	})
+	// --- Stream form-data video to S3 ---
+	upload, err := r.streamVideoForm(ctx, store, userID)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error sending message to SQS",
-		})
-	}
-
-	return ctx.JSON(fiber.Map{
-		"message": "Stored video. Processing scheduled.",
-		"video":   video,
-		"task_id": resp.MessageId,
-	})
-}
-
-func (r *Repository) UploadVideoFromURL(ctx *fiber.Ctx) error {
-	userID := ctx.Locals("userID").(uint)
-
-	videoURL := ctx.FormValue("video_url")
-	title := ctx.FormValue("title")
-
-	if videoURL == "" {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"message": "Missing video_url field",
-		})
-	}
-
-	// --- Download the video ---
-	resp, err := http.Get(videoURL)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
-			"message": "Error downloading video from provided URL",
-		})
-	}
-	defer resp.Body.Close()
-
-	// Determine file extension
-	ext := filepath.Ext(videoURL)
-	if ext == "" {
-		ct := resp.Header.Get("Content-Type")
-		switch ct {
-		case "video/mp4":
-			ext = ".mp4"
-		case "video/webm":
-			ext = ".webm"
-		case "video/ogg":
-			ext = ".ogg"
-		default:
-			ext = ".mp4"
+		switch {
+		case errors.Is(err, errMissingVideoFile), errors.Is(err, errInvalidForm):
+			return ctx.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"message": "Missing video file",
+			})
+		case errors.Is(err, errUploadTooLarge):
+			return ctx.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"message": "Video file is too large",
+			})
 		}
-	}
-
-	safeName := strings.ReplaceAll(title, " ", "_")
-
-	// ✅ Use UUID to ensure uniqueness
-	uniqueID := uuid.NewString()
-	finalFilename := fmt.Sprintf("%d_%s_%s%s", userID, safeName, uniqueID, ext)
-
-	// --- Save temporarily ---
-	tempPath := filepath.Join(os.TempDir(), finalFilename)
-	out, err := os.Create(tempPath)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error creating temporary file",
-		})
-	}
-	defer out.Close()
-	defer os.Remove(tempPath)
-
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error writing temporary file",
-		})
-	}
-
-	// --- Upload to S3 ---
-	bucketName := os.Getenv("S3_BUCKET")
-	region := os.Getenv("AWS_REGION")
-
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error loading AWS config",
-		})
-	}
-
-	client := s3.NewFromConfig(cfg)
-
-	f, err := os.Open(tempPath)
-	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error opening temp file",
-		})
-	}
-	defer f.Close()
-
-	objectKey := fmt.Sprintf("uploads/%s", finalFilename)
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &objectKey,
-		Body:   f,
-	})
-	if err != nil {
-		wrappedErr := fmt.Errorf("error uploading to S3: %w", err)
-		fmt.Println(wrappedErr)
+		log.Printf("Error uploading to S3: %v", err)
 		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Error uploading to S3",
 		})
 	}
 
-	publicURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, region, objectKey)
-
-	// --- Save video record ---
-	status := "uploaded"
-	now := time.Now()
+	// --- Store video record in DB and enqueue task ---
 	video := models.Video{
-		UserID:      userID,
-		Title:       &title,
-		OriginalURL: &publicURL,
-		Status:      &status,
-		UploadedAt:  &now,
+		UserID:    userID,
+		Title:     &upload.Title,
+		SizeBytes: &upload.Size,
+		ContestID: contestID,
 	}
 
-	if err := r.DB.Create(&video).Error; err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error storing in DB",
-		})
+	existing, err := r.storeOriginal(ctx.UserContext(), store, &video, upload.ObjectKey, upload.ChecksumSHA256)
+	if errors.Is(err, errDuplicateVideo) {
+		return duplicateVideo(ctx, store, existing)
 	}
-
-	// --- Enqueue background task ---
-	queueURL := os.Getenv("SQS_QUEUE_URL")
-
-	cfg, err = config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error loading AWS config",
-		})
+		return videoCreationFailed(ctx, err)
 	}
-	sqsClient := sqs.NewFromConfig(cfg)
 
-	payload := map[string]interface{}{
-		"video_id": video.ID,
+	taskID, err := r.createVideo(ctx.UserContext(), &video, decision)
+	if errors.Is(err, errDuplicateVideo) {
+		return duplicateVideo(ctx, store, &video)
+	}
+	if errors.Is(err, errVideoRejected) {
+		return videoRejected(ctx, &video)
 	}
-	body, _ := json.Marshal(payload)
-
-	resp2, err := sqsClient.SendMessage(context.TODO(), &sqs.SendMessageInput{
-		QueueUrl:    &queueURL,
-		MessageBody: aws.String(string(body)),
-	})
 	if err != nil {
-		return ctx.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error sending message to SQS",
-		})
+		return videoCreationFailed(ctx, err)
 	}
+	signVideoURLs(ctx.UserContext(), store, true, &video)
 
 	return ctx.JSON(fiber.Map{
 		"message": "Stored video. Processing scheduled.",
 		"video":   video,
-		"task_id": resp2.MessageId,
+		"task_id": taskID,
 	})
 }
 
 // @Summary      Obtiene todos los videos disponibles para votar
+// @Description  Cada video incluye solo la identidad pública de su jugador (handle, nombre público, ciudad y país)
 // @Tags         videos
 // @Produce      json
-// @Success      200  {array}   models.Video
+// @Success      200  {array}   models.PublicVideo
 // @Router       /public/videos [get]
 func (r *Repository) getAllVideos(context *fiber.Ctx) error {
 
@@ -322,57 +123,84 @@ func (r *Repository) getAllVideos(context *fiber.Ctx) error {
 		)
 	}
 
+	if !r.signVideoList(context, false, *videos) {
+		return nil
+	}
+
+	publicVideos := make([]models.PublicVideo, 0, len(*videos))
+	for _, video := range *videos {
+		publicVideos = append(publicVideos, models.NewPublicVideo(video))
+	}
+
 	context.Status(http.StatusOK).JSON(&fiber.Map{
 		"message": "Se obtuvieron los videos disponibles para votacion corretamente",
-		"data":    videos,
+		"data":    publicVideos,
 	})
 
 	return nil
 }
 
-// @Summary      Un usuario autenticado puede votar por un video
-// @Tags         votes
+// @Summary      Registra una reproducción de un video
+// @Description  Las reproducciones son la exposición con la que el ranking bayesiano pondera los votos. Cada usuario cuenta una sola vez por video y las solicitudes por usuario están limitadas
+// @Tags         videos
 // @Produce      json
-// @Param        id   path      int  true  "ID del video"
-// @Success 200 {string} string "voto registrado con exito"
-// @Router       /public/videos/:videoId/vote [post]
-func (r *Repository) voteForVideo(context *fiber.Ctx) error {
-
-	videoId := context.Params("videoId")
-	userId := context.Locals("userID").(uint)
+// @Param        videoId  path  int  true  "ID del video"
+// @Success      200  {string}  string  "Reproducción registrada"
+// @Failure      401  {string}  string  "Falta token o token inválido"
+// @Failure      404  {string}  string  "Video no encontrado"
+// @Failure      429  {string}  string  "Demasiadas solicitudes, reintentar luego de Retry-After"
+// @Router       /public/videos/{videoId}/views [post]
+func (r *Repository) registerView(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
 
-	// Convertir videoId de string a uint
-	var vid uint
-	if v, err := strconv.ParseUint(videoId, 10, 32); err == nil {
-		vid = uint(v)
-	} else {
+	videoID, err := strconv.ParseUint(context.Params("videoId"), 10, 32)
+	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "videoId inválido")
 	}
 
-	// Verificar si ya existe el voto
-	var existingVote = models.Vote{}
-	err := r.DB.Where("user_id = ? AND video_id = ?", userId, vid).Take(&existingVote).Error
-
-	if err == nil {
-		// Ya existe
-		//return fiber.NewError(fiber.StatusConflict, "Ya votaste por este video")
-		return context.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"message": "Ya votaste por este video",
-		})
-	}
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		video := models.Video{}
+		if err := tx.Select("id").Where("status = 'processed'").First(&video, videoID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errNoVideo
+			}
+			return err
+		}
 
-	// Si no existe, crear el voto
-	newVote := models.Vote{
-		UserID:  userId,
-		VideoID: vid,
+		// Only the first view of each user counts
+		inserted := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.VideoView{VideoID: video.ID, UserID: userID})
+		if inserted.Error != nil || inserted.RowsAffected == 0 {
+			return inserted.Error
+		}
+		if err := tx.Model(&models.Video{}).Where("id = ?", video.ID).
+			UpdateColumn("view_count", gorm.Expr("view_count + 1")).Error; err != nil {
+			return err
+		}
+		// Views move the bayesian ranking as votes do
+		return ranking.Notify(tx, video.ID)
+	})
+	if errors.Is(err, errNoVideo) {
+		return context.Status(http.StatusNotFound).JSON(
+			&fiber.Map{"message": "Video no encontrado"})
 	}
-	if err := r.DB.Create(&newVote).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "No se pudo registrar el voto")
+	if err != nil {
+		log.Printf("Error registering video view: %v", err)
+		return context.Status(http.StatusInternalServerError).JSON(
+			&fiber.Map{"message": "Error al registrar la reproducción"})
 	}
 
-	return context.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Voto registrado con éxito",
-	})
+	return context.JSON(fiber.Map{"message": "Reproducción registrada"})
+}
+
+// viewsPerMinute is how many views a user can register per minute, across
+// every video.
+func viewsPerMinute() int {
+	limit, err := strconv.Atoi(os.Getenv("VIEWS_PER_MINUTE"))
+	if err != nil || limit <= 0 {
+		return 30
+	}
+	return limit
 }
 
 // @Summary      Obtiene todos los videos del usuario autenticado
@@ -396,6 +224,10 @@ func (r *Repository) getMyVideos(context *fiber.Ctx) error {
 		)
 	}
 
+	if !r.signVideoList(context, false, *videos) {
+		return nil
+	}
+
 	// Formatear la respuesta según la especificación
 	var responseVideos []map[string]interface{}
 	for _, video := range *videos {
@@ -403,6 +235,7 @@ func (r *Repository) getMyVideos(context *fiber.Ctx) error {
 			"video_id": video.ID,
 			"title":    video.Title,
 			"status":   video.Status,
+			"votes":    video.VoteCount,
 		}
 
 		if video.UploadedAt != nil {
@@ -462,16 +295,18 @@ func (r *Repository) getVideoDetail(context *fiber.Ctx) error {
 		})
 	}
 
-	// Contar votos del video
-	var voteCount int64
-	r.DB.Model(&models.Vote{}).Where("video_id = ?", vid).Count(&voteCount)
+	videoList := []models.Video{video}
+	if !r.signVideoList(context, true, videoList) {
+		return nil
+	}
+	video = videoList[0]
 
 	// Formatear la respuesta según la especificación
 	response := map[string]interface{}{
 		"video_id": video.ID,
 		"title":    video.Title,
 		"status":   video.Status,
-		"votes":    voteCount,
+		"votes":    video.VoteCount,
 	}
 
 	if video.UploadedAt != nil {
@@ -534,10 +369,7 @@ func (r *Repository) deleteVideo(context *fiber.Ctx) error {
 
 	// Verificar que el video no haya sido publicado para votación
 	// Un video está "publicado" si tiene votos o si su status es "processed"
-	var voteCount int64
-	r.DB.Model(&models.Vote{}).Where("video_id = ?", vid).Count(&voteCount)
-
-	if voteCount > 0 {
+	if video.VoteCount > 0 {
 		return context.Status(http.StatusBadRequest).JSON(&fiber.Map{
 			"message": "No se puede eliminar el video porque ya tiene votos",
 		})
@@ -549,30 +381,23 @@ func (r *Repository) deleteVideo(context *fiber.Ctx) error {
 		})
 	}
 
-	// Eliminar el video de la base de datos
-	if err := r.DB.Delete(&video).Error; err != nil {
+	// Eliminar el video y encolar, en la misma transacción, el borrado de sus
+	// objetos en almacenamiento (original, procesado, miniaturas y derivados)
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&video).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("video_id = ?", video.ID).Delete(&models.VoteEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(models.VideoDeletions(video)).Error
+	})
+	if err != nil {
 		return context.Status(http.StatusInternalServerError).JSON(&fiber.Map{
 			"message": "Error al eliminar el video",
 		})
 	}
 
-	// Eliminar archivos físicos asociados (original y procesado) si existen
-	if video.OriginalURL != nil && *video.OriginalURL != "" {
-		path := "." + *video.OriginalURL
-		fsPath := filepath.FromSlash(path)
-		if err := os.Remove(fsPath); err != nil && !os.IsNotExist(err) {
-			log.Printf("No se pudo eliminar archivo original %s: %v", fsPath, err)
-		}
-	}
-
-	if video.ProcessedURL != nil && *video.ProcessedURL != "" {
-		path := "." + *video.ProcessedURL
-		fsPath := filepath.FromSlash(path)
-		if err := os.Remove(fsPath); err != nil && !os.IsNotExist(err) {
-			log.Printf("No se pudo eliminar archivo procesado %s: %v", fsPath, err)
-		}
-	}
-
 	context.Status(http.StatusOK).JSON(&fiber.Map{
 		"message":  "El video ha sido eliminado exitosamente",
 		"video_id": vid,
@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"back-end-todolist/models"
+	"back-end-todolist/ranking"
+	"back-end-todolist/voting"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errVoteExists   = errors.New("vote already exists")
+	errVoteNotFound = errors.New("vote not found")
+	errNoVideo      = errors.New("video not found")
+)
+
+// @Summary      Un usuario autenticado puede votar por un video
+// @Description  Solo se puede votar por videos procesados de otros usuarios, dentro de la ventana de votación del concurso. Cada rechazo devuelve un code distinto (video_not_found, video_not_votable, self_vote, voter_type_not_allowed, account_too_new, voting_not_started, voting_closed, contest_finalized)
+// @Tags         votes
+// @Produce      json
+// @Param        id   path      int  true  "ID del video"
+// @Success 200 {string} string "voto registrado con exito"
+// @Failure      403 {string} string "El usuario no puede votar por este video"
+// @Failure      404 {string} string "Video no encontrado"
+// @Failure      409 {string} string "Ya votaste por este video o el video no está procesado"
+// @Failure      429 {string} string "El voto fue retirado hace poco, reintentar luego de Retry-After"
+// @Router       /public/videos/:videoId/vote [post]
+func (r *Repository) voteForVideo(context *fiber.Ctx) error {
+
+	videoId := context.Params("videoId")
+	userId := context.Locals("userID").(uint)
+
+	// Convertir videoId de string a uint
+	var vid uint
+	if v, err := strconv.ParseUint(videoId, 10, 32); err == nil {
+		vid = uint(v)
+	} else {
+		return fiber.NewError(fiber.StatusBadRequest, "videoId inválido")
+	}
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := r.checkVoteEligibility(tx, userId, vid); err != nil {
+			return err
+		}
+
+		// Volver a votar tras retirar el voto respeta el intervalo mínimo
+		lastRetraction, err := lastVoteEvent(tx, userId, vid, models.VoteRetract)
+		if err != nil {
+			return err
+		}
+		if denied := r.Voting.CheckRecast(lastRetraction, time.Now()); denied != nil {
+			return denied
+		}
+
+		// Crear el voto solo si no existe; con votos concurrentes del mismo
+		// usuario, uno inserta y los demás no afectan filas
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Vote{UserID: userId, VideoID: vid})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVoteExists
+		}
+
+		if err := tx.Model(&models.Video{}).Where("id = ?", vid).
+			UpdateColumn("vote_count", gorm.Expr("vote_count + 1")).Error; err != nil {
+			return err
+		}
+		if err := ranking.Notify(tx, vid); err != nil {
+			return err
+		}
+		return tx.Create(&models.VoteEvent{UserID: userId, VideoID: vid, Action: models.VoteCast}).Error
+	})
+
+	var denied *voting.Denied
+	switch {
+	case errors.Is(err, errNoVideo):
+		return context.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Video no encontrado",
+			"code":    "video_not_found",
+		})
+	case errors.Is(err, errVoteExists):
+		return context.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Ya votaste por este video",
+		})
+	case errors.As(err, &denied):
+		return voteDenied(context, denied)
+	case err != nil:
+		return fiber.NewError(fiber.StatusInternalServerError, "No se pudo registrar el voto")
+	}
+
+	return context.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Voto registrado con éxito",
+	})
+}
+
+// @Summary      Retira el voto del usuario autenticado sobre un video
+// @Description  No se permite si la votación del concurso del video ya cerró (configurable) ni, en ningún caso, después de tomadas sus posiciones finales. Retirar un voto no tiene espera, pero volver a votar sí respeta el intervalo mínimo
+// @Tags         votes
+// @Produce      json
+// @Param        id   path      int  true  "ID del video"
+// @Success      200 {string} string "Voto retirado"
+// @Failure      403 {string} string "El retiro de votos está deshabilitado, el concurso cerró o ya tiene posiciones finales"
+// @Failure      404 {string} string "No has votado por este video"
+// @Router       /public/videos/:videoId/vote [delete]
+func (r *Repository) retractVote(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+
+	vid, err := strconv.ParseUint(context.Params("videoId"), 10, 32)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "videoId inválido")
+	}
+	videoID := uint(vid)
+
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the vote keeps a concurrent retraction from passing the
+		// same checks
+		vote := models.Vote{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND video_id = ?", userID, videoID).
+			Take(&vote).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errVoteNotFound
+			}
+			return err
+		}
+
+		closed, finalized, err := videoContestState(tx, videoID)
+		if err != nil {
+			return err
+		}
+		if denied := r.Voting.CheckRetraction(closed, finalized); denied != nil {
+			return denied
+		}
+
+		deleted := tx.Where("user_id = ? AND video_id = ?", userID, videoID).Delete(&models.Vote{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return errVoteNotFound
+		}
+		if err := tx.Model(&models.Video{}).Where("id = ?", videoID).
+			UpdateColumn("vote_count", gorm.Expr("GREATEST(vote_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		if err := ranking.Notify(tx, videoID); err != nil {
+			return err
+		}
+		return tx.Create(&models.VoteEvent{UserID: userID, VideoID: videoID, Action: models.VoteRetract}).Error
+	})
+
+	var denied *voting.Denied
+	switch {
+	case errors.Is(err, errVoteNotFound), errors.Is(err, errNoVideo):
+		return context.Status(http.StatusNotFound).JSON(fiber.Map{
+			"message": "No has votado por este video",
+		})
+	case errors.As(err, &denied):
+		return voteDenied(context, denied)
+	case err != nil:
+		return context.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"message": "No se pudo retirar el voto",
+		})
+	}
+
+	return context.JSON(fiber.Map{
+		"message":  "Voto retirado",
+		"video_id": videoID,
+	})
+}
+
+// @Summary      Indica si el usuario autenticado votó por un video
+// @Description  Si votó, retraction indica por qué no puede retirar el voto (null si puede). Si no votó, vote indica por qué no puede votar (ausente si puede)
+// @Tags         votes
+// @Produce      json
+// @Param        id   path      int  true  "ID del video"
+// @Success      200 {object}  map[string]interface{}
+// @Router       /public/videos/:videoId/vote [get]
+func (r *Repository) getMyVote(context *fiber.Ctx) error {
+	userID := context.Locals("userID").(uint)
+
+	vid, err := strconv.ParseUint(context.Params("videoId"), 10, 32)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "videoId inválido")
+	}
+	videoID := uint(vid)
+
+	var voted int64
+	if err := r.DB.Model(&models.Vote{}).Where("user_id = ? AND video_id = ?", userID, videoID).Count(&voted).Error; err != nil {
+		return context.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error al obtener el voto",
+		})
+	}
+
+	closed, finalized, err := videoContestState(r.DB, videoID)
+	if errors.Is(err, errNoVideo) {
+		return context.Status(http.StatusNotFound).JSON(fiber.Map{
+			"message": "Video no encontrado",
+		})
+	}
+	lastCast, errCast := lastVoteEvent(r.DB, userID, videoID, models.VoteCast)
+	lastRetraction, errRetraction := lastVoteEvent(r.DB, userID, videoID, models.VoteRetract)
+	if err != nil || errCast != nil || errRetraction != nil {
+		return context.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Error al obtener el voto",
+		})
+	}
+
+	now := time.Now()
+	var denied *voting.Denied
+	if voted > 0 {
+		denied = r.Voting.CheckRetraction(closed, finalized)
+	} else if err := r.checkVoteEligibility(r.DB, userID, videoID); err != nil {
+		if !errors.As(err, &denied) {
+			return context.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Error al obtener el voto",
+			})
+		}
+	} else {
+		denied = r.Voting.CheckRecast(lastRetraction, now)
+	}
+
+	response := fiber.Map{
+		"video_id":   videoID,
+		"voted":      voted > 0,
+		"retraction": nil,
+	}
+	if voted > 0 && !lastCast.IsZero() {
+		response["voted_at"] = lastCast
+	}
+	if denied != nil {
+		restriction := fiber.Map{"code": denied.Code, "message": denied.Message}
+		if denied.RetryAfter > 0 {
+			restriction["available_at"] = now.Add(denied.RetryAfter)
+		}
+		// The restriction applies to the change the caller can make next
+		if voted > 0 {
+			response["retraction"] = restriction
+		} else {
+			response["vote"] = restriction
+		}
+	}
+
+	return context.JSON(fiber.Map{
+		"message": "Estado del voto obtenido correctamente",
+		"data":    response,
+	})
+}
+
+// checkVoteEligibility applies the vote policy, with the overrides of the
+// video's contest, to a vote of the user for the video. Returns errNoVideo or
+// *voting.Denied when the vote is not allowed.
+func (r *Repository) checkVoteEligibility(db *gorm.DB, userID, videoID uint) error {
+	video := models.Video{}
+	if err := db.Select("id", "user_id", "status", "contest_id").First(&video, videoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errNoVideo
+		}
+		return err
+	}
+
+	user := models.User{}
+	if err := db.Select("id", "type", "created_at").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	policy := r.VotePolicy
+	window := voting.Window{}
+	if video.ContestID != nil {
+		contest := models.Contest{}
+		err := db.First(&contest, *video.ContestID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			policy = policy.With(contestOverrides(contest))
+			window.StartsAt, window.EndsAt = contest.VotingWindow()
+			window.Finalized = contest.FinalizedAt != nil
+		}
+	}
+
+	voter := voting.Voter{ID: user.ID, Type: aws.ToString(user.Type), CreatedAt: user.CreatedAt}
+	candidate := voting.Candidate{OwnerID: video.UserID, Status: aws.ToString(video.Status)}
+	if denied := policy.Check(voter, candidate, window, time.Now()); denied != nil {
+		return denied
+	}
+	return nil
+}
+
+func contestOverrides(contest models.Contest) voting.Overrides {
+	overrides := voting.Overrides{
+		AllowSelfVotes: contest.AllowSelfVotes,
+		VoterTypes:     contest.VoterTypes,
+	}
+	if contest.MinVoterAccountAgeHours != nil {
+		age := time.Duration(*contest.MinVoterAccountAgeHours) * time.Hour
+		overrides.MinAccountAge = &age
+	}
+	return overrides
+}
+
+// lastVoteEvent returns when the user last cast or retracted (action) a vote
+// on the video, or the zero time if there is no record of it.
+func lastVoteEvent(db *gorm.DB, userID, videoID uint, action string) (time.Time, error) {
+	var last *time.Time
+	err := db.Model(&models.VoteEvent{}).
+		Select("MAX(created_at)").
+		Where("user_id = ? AND video_id = ? AND action = ?", userID, videoID, action).
+		Scan(&last).Error
+	if err != nil || last == nil {
+		return time.Time{}, err
+	}
+	return *last, nil
+}
+
+// videoContestState reports whether the voting window of the video's
+// contest already closed and whether its final standings were taken. Videos
+// outside a contest never close.
+func videoContestState(db *gorm.DB, videoID uint) (closed, finalized bool, err error) {
+	video := models.Video{}
+	if err := db.Select("id", "contest_id").First(&video, videoID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, false, errNoVideo
+		}
+		return false, false, err
+	}
+	if video.ContestID == nil {
+		return false, false, nil
+	}
+
+	contest := models.Contest{}
+	if err := db.First(&contest, *video.ContestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return contest.VotingClosed(time.Now()), contest.FinalizedAt != nil, nil
+}
+
+// voteDenied writes the response for a vote change the rules do not allow.
+func voteDenied(ctx *fiber.Ctx, denied *voting.Denied) error {
+	if denied.RetryAfter > 0 {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(denied.RetryAfter.Seconds())))
+	}
+	return ctx.Status(denied.Status).JSON(fiber.Map{
+		"message": denied.Message,
+		"code":    denied.Code,
+	})
+}
@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ClamAV scans files with a clamd daemon using the INSTREAM command, so the
+// file is streamed over the socket and never written to the daemon's disk.
+type ClamAV struct {
+	// TCP address of clamd, e.g. clamav:3310
+	Addr    string
+	Timeout time.Duration
+	// Size of each INSTREAM chunk; defaults to 64 KiB
+	ChunkSize int
+}
+
+func (c *ClamAV) Scan(ctx context.Context, body io.Reader) (Result, error) {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: error connecting to clamd: %v", ErrUnscannable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if err := c.stream(conn, body); err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnscannable, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return Result{}, fmt.Errorf("%w: error reading clamd reply: %v", ErrUnscannable, err)
+	}
+	return parseReply(reply)
+}
+
+func (c *ClamAV) stream(conn net.Conn, body io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	size := c.ChunkSize
+	if size <= 0 {
+		size = 64 * 1024
+	}
+	chunk := make([]byte, size)
+	header := make([]byte, 4)
+
+	for {
+		n, err := io.ReadFull(body, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(header, uint32(n))
+			if _, werr := conn.Write(header); werr != nil {
+				// clamd closes the socket when the stream exceeds StreamMaxLength
+				return fmt.Errorf("clamd stopped reading the stream: %w", werr)
+			}
+			if _, werr := conn.Write(chunk[:n]); werr != nil {
+				return fmt.Errorf("clamd stopped reading the stream: %w", werr)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading file: %w", err)
+		}
+	}
+
+	// A zero-length chunk ends the stream
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseReply reads the clamd verdict, e.g. "stream: OK",
+// "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR".
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return Result{Signature: signature}, nil
+	}
+
+	return Result{}, fmt.Errorf("%w: clamd replied %q", ErrUnscannable, reply)
+}
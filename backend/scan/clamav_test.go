@@ -0,0 +1,96 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers INSTREAM requests, flagging streams that contain "EICAR".
+func fakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				if command, err := reader.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+					return
+				}
+
+				received := bytes.Buffer{}
+				header := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(reader, header); err != nil {
+						return
+					}
+					size := binary.BigEndian.Uint32(header)
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&received, reader, int64(size)); err != nil {
+						return
+					}
+				}
+
+				if strings.Contains(received.String(), "EICAR") {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestClamAV_Scan(t *testing.T) {
+	scanner := &ClamAV{Addr: fakeClamd(t), Timeout: 5 * time.Second, ChunkSize: 7}
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("a harmless video body"))
+	if err != nil || !result.Clean {
+		t.Fatalf("expected clean, got %+v, %v", result, err)
+	}
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader("header EICAR payload"))
+	if err != nil || result.Clean || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected Eicar-Test-Signature, got %+v, %v", result, err)
+	}
+}
+
+func TestClamAV_Unreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+
+	scanner := &ClamAV{Addr: addr, Timeout: time.Second}
+	if _, err := scanner.Scan(context.Background(), strings.NewReader("x")); !errors.Is(err, ErrUnscannable) {
+		t.Fatalf("expected ErrUnscannable, got %v", err)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	if _, err := parseReply("INSTREAM size limit exceeded. ERROR\x00"); !errors.Is(err, ErrUnscannable) {
+		t.Errorf("expected ErrUnscannable for size limit, got %v", err)
+	}
+	if result, err := parseReply("stream: OK\x00"); err != nil || !result.Clean {
+		t.Errorf("expected clean, got %+v, %v", result, err)
+	}
+}
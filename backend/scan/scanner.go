@@ -0,0 +1,51 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnscannable is returned when the scanner could not reach a verdict,
+// e.g. because the file exceeds its size limit.
+var ErrUnscannable = errors.New("file could not be scanned")
+
+// Result is the verdict on a scanned file.
+type Result struct {
+	Clean bool
+	// Name of the detected threat when the file is not clean
+	Signature string
+}
+
+// Scanner inspects uploaded files before they reach ffmpeg.
+type Scanner interface {
+	Scan(ctx context.Context, body io.Reader) (Result, error)
+}
+
+// Noop accepts every file. It is used when no scanner is configured.
+type Noop struct{}
+
+func (Noop) Scan(ctx context.Context, body io.Reader) (Result, error) {
+	return Result{Clean: true}, nil
+}
+
+// FromEnv returns the scanner selected by SCANNER: "clamav" talks to the
+// clamd at CLAMAV_ADDR, anything else disables scanning.
+func FromEnv() Scanner {
+	if os.Getenv("SCANNER") != "clamav" {
+		return Noop{}
+	}
+
+	addr := os.Getenv("CLAMAV_ADDR")
+	if addr == "" {
+		addr = "localhost:3310"
+	}
+	timeout, err := time.ParseDuration(os.Getenv("CLAMAV_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+
+	return &ClamAV{Addr: addr, Timeout: timeout}
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// AWSSettings are the connection settings of the S3 and SQS clients. The
+// endpoints are empty for AWS itself and point to stand-ins such as MinIO,
+// ElasticMQ or LocalStack for offline development and CI.
+type AWSSettings struct {
+	Region      string
+	S3Endpoint  string
+	SQSEndpoint string
+
+	// Endpoint used in the presigned URLs handed to browsers, for when the
+	// backend reaches S3 through an internal host (e.g. http://minio:9000).
+	// Defaults to S3Endpoint.
+	S3PublicEndpoint string
+
+	// MinIO and LocalStack need bucket-in-path addressing
+	S3ForcePathStyle bool
+
+	// Static credentials; when empty the default AWS credential chain is used
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Attempts per request, including the first one
+	MaxAttempts int
+	// Connections kept open per host; S3 and SQS are a single host each
+	MaxConnsPerHost int
+}
+
+// LoadAWSSettings reads the settings from the environment.
+func LoadAWSSettings() AWSSettings {
+	pathStyle, _ := strconv.ParseBool(os.Getenv("S3_FORCE_PATH_STYLE"))
+
+	maxAttempts, err := strconv.Atoi(os.Getenv("AWS_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	maxConns, err := strconv.Atoi(os.Getenv("AWS_MAX_CONNS_PER_HOST"))
+	if err != nil || maxConns <= 0 {
+		maxConns = 100
+	}
+
+	return AWSSettings{
+		Region:           os.Getenv("AWS_REGION"),
+		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
+		SQSEndpoint:      os.Getenv("SQS_ENDPOINT"),
+		S3PublicEndpoint: os.Getenv("S3_PUBLIC_ENDPOINT"),
+		S3ForcePathStyle: pathStyle,
+		AccessKeyID:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey:  os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:     os.Getenv("AWS_SESSION_TOKEN"),
+		MaxAttempts:      maxAttempts,
+		MaxConnsPerHost:  maxConns,
+	}
+}
+
+// LoadAWSConfig builds the configuration shared by every AWS client. It is
+// meant to be loaded once at startup: credentials are resolved and cached
+// once, and every client built from it shares one pooled HTTP transport.
+func LoadAWSConfig(ctx context.Context, settings AWSSettings) (aws.Config, error) {
+	httpClient := awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = 5 * time.Second
+			d.KeepAlive = 30 * time.Second
+		}).
+		WithTransportOptions(func(t *http.Transport) {
+			t.MaxIdleConns = 2 * settings.MaxConnsPerHost
+			t.MaxIdleConnsPerHost = settings.MaxConnsPerHost
+			t.IdleConnTimeout = 90 * time.Second
+			t.TLSHandshakeTimeout = 5 * time.Second
+			// Bodies can be large, so only the wait for headers is bounded
+			t.ResponseHeaderTimeout = 30 * time.Second
+			t.ExpectContinueTimeout = time.Second
+		})
+
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(settings.Region),
+		config.WithHTTPClient(httpClient),
+		config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = settings.MaxAttempts
+				o.MaxBackoff = 5 * time.Second
+			})
+		}),
+	}
+
+	if settings.AccessKeyID != "" && settings.SecretAccessKey != "" {
+		options = append(options, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(settings.AccessKeyID, settings.SecretAccessKey, settings.SessionToken),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+// NewS3Client returns a client for the configured S3 endpoint.
+func NewS3Client(cfg aws.Config, settings AWSSettings) *s3.Client {
+	return newS3Client(cfg, settings, settings.S3Endpoint)
+}
+
+// NewS3PresignClient returns a presign client whose URLs use the public S3
+// endpoint, so they work from outside the backend network.
+func NewS3PresignClient(cfg aws.Config, settings AWSSettings) *s3.PresignClient {
+	endpoint := settings.S3PublicEndpoint
+	if endpoint == "" {
+		endpoint = settings.S3Endpoint
+	}
+	return s3.NewPresignClient(newS3Client(cfg, settings, endpoint))
+}
+
+func newS3Client(cfg aws.Config, settings AWSSettings, endpoint string) *s3.Client {
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = settings.S3ForcePathStyle
+	})
+}
+
+// NewSQSClient returns a client for the configured SQS endpoint.
+func NewSQSClient(cfg aws.Config, settings AWSSettings) *sqs.Client {
+	return sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if settings.SQSEndpoint != "" {
+			o.BaseEndpoint = aws.String(settings.SQSEndpoint)
+		}
+	})
+}
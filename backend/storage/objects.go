@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MinPartSize is the smallest part S3 accepts in a multipart upload, except
+// for the last one.
+const MinPartSize = manager.MinUploadPartSize
+
+// ObjectStore is the storage layer for video objects kept in S3.
+type ObjectStore struct {
+	Client   *s3.Client
+	Presign  *s3.PresignClient
+	Uploader *manager.Uploader
+	Bucket   string
+	Region   string
+}
+
+type PresignedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+}
+
+// NewObjectStore builds the store once per process; it is safe for
+// concurrent use and shares the connection pool of cfg.
+func NewObjectStore(cfg aws.Config, settings AWSSettings) *ObjectStore {
+	client := NewS3Client(cfg, settings)
+
+	return &ObjectStore{
+		Client:  client,
+		Presign: NewS3PresignClient(cfg, settings),
+		Uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			// Bounded buffering keeps memory flat under concurrent streamed uploads
+			u.PartSize = manager.MinUploadPartSize
+			u.Concurrency = 2
+		}),
+		Bucket: os.Getenv("S3_BUCKET"),
+		Region: settings.Region,
+	}
+}
+
+// PresignPut returns a PUT request the client can use to upload an object
+// directly. Size and checksum (base64 SHA-256) are part of the signature, so
+// S3 rejects bodies that do not match what was declared.
+func (s *ObjectStore) PresignPut(ctx context.Context, key, contentType string, size int64, checksumSHA256 string, ttl time.Duration) (*PresignedRequest, error) {
+	input := &s3.PutObjectInput{
+		Bucket:        &s.Bucket,
+		Key:           &key,
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if checksumSHA256 != "" {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		input.ChecksumSHA256 = aws.String(checksumSHA256)
+	}
+
+	req, err := s.Presign.PresignPutObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("error presigning upload: %w", err)
+	}
+
+	return &PresignedRequest{Method: req.Method, URL: req.URL, Headers: req.SignedHeader}, nil
+}
+
+// Head returns the object metadata, including its SHA-256 checksum when one
+// was stored with it.
+func (s *ObjectStore) Head(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	return s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       &s.Bucket,
+		Key:          &key,
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+}
+
+// Upload streams body into key, switching to a multipart upload for large
+// bodies, so callers do not need to know the size in advance.
+func (s *ObjectStore) Upload(ctx context.Context, key string, body io.Reader, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	if _, err := s.Uploader.Upload(ctx, input); err != nil {
+		return fmt.Errorf("error uploading %s: %w", key, err)
+	}
+	return nil
+}
+
+// CreateMultipart starts a multipart upload of key and returns its id. Its
+// parts are sent with UploadPart and it becomes the object once completed.
+func (s *ObjectStore) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	out, err := s.Client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("error starting multipart upload of %s: %w", key, err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart stores part number n of a multipart upload and returns its
+// ETag. Every part but the last must be at least MinPartSize.
+func (s *ObjectStore) UploadPart(ctx context.Context, key, uploadID string, n int32, part []byte) (string, error) {
+	out, err := s.Client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        &s.Bucket,
+		Key:           &key,
+		UploadId:      &uploadID,
+		PartNumber:    aws.Int32(n),
+		Body:          bytes.NewReader(part),
+		ContentLength: aws.Int64(int64(len(part))),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading part %d of %s: %w", n, key, err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// CompleteMultipart joins the parts, in order, into the object.
+func (s *ObjectStore) CompleteMultipart(ctx context.Context, key, uploadID string, parts []types.CompletedPart) error {
+	_, err := s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.Bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("error completing multipart upload of %s: %w", key, err)
+	}
+	return nil
+}
+
+// AbortMultipart discards a multipart upload and the parts stored for it.
+// Uploads that no longer exist are not an error.
+func (s *ObjectStore) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &s.Bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	var noUpload *types.NoSuchUpload
+	if err != nil && !errors.As(err, &noUpload) {
+		return fmt.Errorf("error aborting multipart upload of %s: %w", key, err)
+	}
+	return nil
+}
+
+// Copy duplicates src into dst inside the bucket, keeping its metadata.
+func (s *ObjectStore) Copy(ctx context.Context, src, dst string) error {
+	_, err := s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &s.Bucket,
+		Key:        &dst,
+		CopySource: aws.String(s.copySource(src)),
+	})
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
+
+// copySource is the URL-encoded bucket and key CopyObject reads from.
+func (s *ObjectStore) copySource(key string) string {
+	return (&url.URL{Path: s.Bucket + "/" + key}).EscapedPath()
+}
+
+// SetStorageClass moves an object to another storage class by copying it
+// onto itself. Objects already in that class are left untouched.
+func (s *ObjectStore) SetStorageClass(ctx context.Context, key string, class types.StorageClass) error {
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.Bucket, Key: &key})
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", key, err)
+	}
+	if string(head.StorageClass) == string(class) {
+		return nil
+	}
+
+	_, err = s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            &s.Bucket,
+		Key:               &key,
+		CopySource:        aws.String(s.copySource(key)),
+		StorageClass:      class,
+		MetadataDirective: types.MetadataDirectiveCopy,
+	})
+	if err != nil {
+		return fmt.Errorf("error changing storage class of %s: %w", key, err)
+	}
+	return nil
+}
+
+// Open returns a reader for the object content. The caller must close it.
+func (s *ObjectStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// Delete removes the given keys. Missing keys are not an error.
+func (s *ObjectStore) Delete(ctx context.Context, keys ...string) error {
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		out, err := s.Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: &s.Bucket,
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("error deleting objects: %w", err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("error deleting %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+	}
+	return nil
+}
+
+// List returns every object stored under prefix.
+func (s *ObjectStore) List(ctx context.Context, prefix string) ([]types.Object, error) {
+	objects := []types.Object{}
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: &s.Bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+
+	return objects, nil
+}
+
+// PresignGet returns a short-lived URL to read a private object.
+func (s *ObjectStore) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := s.Presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("error presigning %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// Download copies the object content into a local file.
+func (s *ObjectStore) Download(ctx context.Context, key, localPath string) error {
+	body, err := s.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("error creating local file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, body); err != nil {
+		return fmt.Errorf("error copying file content: %w", err)
+	}
+	return nil
+}
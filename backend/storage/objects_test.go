@@ -0,0 +1,21 @@
+package storage
+
+import "testing"
+
+func TestObjectStore_CopySource(t *testing.T) {
+	store := &ObjectStore{Bucket: "videos"}
+
+	cases := []struct {
+		key, want string
+	}{
+		{"uploads/sha256/abc", "videos/uploads/sha256/abc"},
+		{"uploads/1_id.mp4?a#b", "videos/uploads/1_id.mp4%3Fa%23b"},
+		{"uploads/my video.mp4", "videos/uploads/my%20video.mp4"},
+	}
+
+	for _, c := range cases {
+		if got := store.copySource(c.key); got != c.want {
+			t.Errorf("copySource(%q) = %q, want %q", c.key, got, c.want)
+		}
+	}
+}
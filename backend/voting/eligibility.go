@@ -0,0 +1,144 @@
+package voting
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Policy decides who can vote for which videos. Contests can override it.
+type Policy struct {
+	// Allow players to vote for their own videos
+	AllowSelfVotes bool `json:"allowSelfVotes"`
+	// User types allowed to vote; empty allows every type
+	VoterTypes []string `json:"voterTypes"`
+	// Minimum age of the voter's account
+	MinAccountAge time.Duration `json:"-"`
+}
+
+// LoadPolicy reads the default policy from the environment.
+func LoadPolicy() Policy {
+	return Policy{
+		AllowSelfVotes: envBool("VOTE_ALLOW_SELF_VOTES", false),
+		VoterTypes:     ParseTypes(os.Getenv("VOTE_VOTER_TYPES")),
+		MinAccountAge:  envDuration("VOTE_MIN_ACCOUNT_AGE", 0),
+	}
+}
+
+// Overrides are the policy settings of a contest; nil keeps the default.
+type Overrides struct {
+	AllowSelfVotes *bool
+	VoterTypes     *string
+	MinAccountAge  *time.Duration
+}
+
+// With returns the policy with the contest overrides applied.
+func (p Policy) With(o Overrides) Policy {
+	if o.AllowSelfVotes != nil {
+		p.AllowSelfVotes = *o.AllowSelfVotes
+	}
+	if o.VoterTypes != nil {
+		p.VoterTypes = ParseTypes(*o.VoterTypes)
+	}
+	if o.MinAccountAge != nil {
+		p.MinAccountAge = *o.MinAccountAge
+	}
+	return p
+}
+
+// ParseTypes splits a comma separated list of user types.
+func ParseTypes(list string) []string {
+	types := []string{}
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Voter is the user casting a vote. A nil CreatedAt is an account older than
+// the tracking of account ages, so it passes the age check.
+type Voter struct {
+	ID        uint
+	Type      string
+	CreatedAt *time.Time
+}
+
+// Candidate is the video being voted for.
+type Candidate struct {
+	OwnerID uint
+	Status  string
+}
+
+// Window is when a contest accepts votes; nil bounds are open.
+type Window struct {
+	StartsAt *time.Time
+	EndsAt   *time.Time
+	// The final standings were taken, so no vote counts any more
+	Finalized bool
+}
+
+// Check returns the first rule that keeps voter from voting for video, or
+// nil. Every rule has its own code.
+func (p Policy) Check(voter Voter, video Candidate, window Window, now time.Time) *Denied {
+	if video.Status != "processed" {
+		return &Denied{
+			Code:    "video_not_votable",
+			Message: "Only processed videos can receive votes",
+			Status:  http.StatusConflict,
+		}
+	}
+
+	if !p.AllowSelfVotes && video.OwnerID == voter.ID {
+		return &Denied{
+			Code:    "self_vote",
+			Message: "You cannot vote for your own video",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	if len(p.VoterTypes) > 0 && !slices.Contains(p.VoterTypes, voter.Type) {
+		return &Denied{
+			Code:    "voter_type_not_allowed",
+			Message: "Your account type cannot vote in this contest",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	if p.MinAccountAge > 0 && voter.CreatedAt != nil {
+		if wait := voter.CreatedAt.Add(p.MinAccountAge).Sub(now); wait > 0 {
+			return &Denied{
+				Code:       "account_too_new",
+				Message:    "Your account is too new to vote",
+				Status:     http.StatusForbidden,
+				RetryAfter: max(wait, time.Second),
+			}
+		}
+	}
+
+	if window.StartsAt != nil && now.Before(*window.StartsAt) {
+		return &Denied{
+			Code:       "voting_not_started",
+			Message:    "Voting has not started for this contest",
+			Status:     http.StatusForbidden,
+			RetryAfter: max(window.StartsAt.Sub(now), time.Second),
+		}
+	}
+
+	if window.EndsAt != nil && !now.Before(*window.EndsAt) {
+		return &Denied{
+			Code:    "voting_closed",
+			Message: "Voting has closed for this contest",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	if window.Finalized {
+		return finalizedDenied()
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package voting
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	newAccount := now.Add(-time.Minute)
+
+	policy := Policy{VoterTypes: []string{"voter", "player"}, MinAccountAge: 24 * time.Hour}
+	voter := Voter{ID: 1, Type: "voter"}
+	video := Candidate{OwnerID: 2, Status: "processed"}
+
+	cases := []struct {
+		name   string
+		policy Policy
+		voter  Voter
+		video  Candidate
+		window Window
+		code   string
+		status int
+	}{
+		{"eligible", policy, voter, video, Window{StartsAt: &past, EndsAt: &future}, "", 0},
+		{"unprocessed", policy, voter, Candidate{OwnerID: 2, Status: "uploaded"}, Window{}, "video_not_votable", http.StatusConflict},
+		{"self vote", policy, Voter{ID: 2, Type: "player"}, video, Window{}, "self_vote", http.StatusForbidden},
+		{"self vote allowed", Policy{AllowSelfVotes: true}, Voter{ID: 2}, video, Window{}, "", 0},
+		{"voter type", policy, Voter{ID: 1, Type: "jury"}, video, Window{}, "voter_type_not_allowed", http.StatusForbidden},
+		{"new account", policy, Voter{ID: 1, Type: "voter", CreatedAt: &newAccount}, video, Window{}, "account_too_new", http.StatusForbidden},
+		{"untracked account age", policy, voter, video, Window{}, "", 0},
+		{"not started", policy, voter, video, Window{StartsAt: &future}, "voting_not_started", http.StatusForbidden},
+		{"closed", policy, voter, video, Window{EndsAt: &past}, "voting_closed", http.StatusForbidden},
+		{"finalized", policy, voter, video, Window{EndsAt: &future, Finalized: true}, "contest_finalized", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		denied := c.policy.Check(c.voter, c.video, c.window, now)
+		switch {
+		case c.code == "" && denied != nil:
+			t.Errorf("%s: expected no denial, got %v", c.name, denied)
+		case c.code != "" && (denied == nil || denied.Code != c.code || denied.Status != c.status):
+			t.Errorf("%s: expected %s (%d), got %+v", c.name, c.code, c.status, denied)
+		}
+	}
+}
+
+func TestPolicy_With(t *testing.T) {
+	allow := true
+	types := "jury, voter"
+	age := time.Hour
+
+	policy := Policy{VoterTypes: []string{"player"}}.With(Overrides{
+		AllowSelfVotes: &allow,
+		VoterTypes:     &types,
+		MinAccountAge:  &age,
+	})
+	if !policy.AllowSelfVotes || len(policy.VoterTypes) != 2 || policy.VoterTypes[0] != "jury" || policy.MinAccountAge != age {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	if kept := (Policy{MinAccountAge: age}).With(Overrides{}); kept.MinAccountAge != age {
+		t.Errorf("expected the default to be kept, got %+v", kept)
+	}
+}
@@ -0,0 +1,113 @@
+package voting
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Rules configure when a vote can be retracted or cast again.
+type Rules struct {
+	// Allow voters to retract their votes
+	AllowRetraction bool `json:"allowRetraction"`
+	// Allow retracting votes on videos of contests that already closed
+	RetractAfterClose bool `json:"retractAfterClose"`
+	// Minimum time between retracting a vote and casting it again on the
+	// same video. Retracting is never delayed, so a mistaken vote can be
+	// undone right away
+	ChangeCooldown time.Duration `json:"-"`
+}
+
+// LoadRules reads the rules from the environment.
+func LoadRules() Rules {
+	return Rules{
+		AllowRetraction:   envBool("VOTE_RETRACTION_ENABLED", true),
+		RetractAfterClose: envBool("VOTE_RETRACTION_AFTER_CLOSE", false),
+		ChangeCooldown:    envDuration("VOTE_CHANGE_COOLDOWN", time.Minute),
+	}
+}
+
+// Denied is the error returned when a vote change is not allowed.
+type Denied struct {
+	Code    string
+	Message string
+	Status  int
+	// Only set when the change is allowed once a cooldown ends
+	RetryAfter time.Duration
+}
+
+func (e *Denied) Error() string {
+	return fmt.Sprintf("vote %s: %s", e.Code, e.Message)
+}
+
+// CheckRetraction returns why a vote cannot be retracted, or nil.
+// contestClosed is whether the voting of the video's contest already closed
+// and contestFinalized whether its final standings were taken.
+func (r Rules) CheckRetraction(contestClosed, contestFinalized bool) *Denied {
+	if !r.AllowRetraction {
+		return &Denied{
+			Code:    "retraction_disabled",
+			Message: "Votes cannot be retracted",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	if contestFinalized {
+		return finalizedDenied()
+	}
+
+	if contestClosed && !r.RetractAfterClose {
+		return &Denied{
+			Code:    "contest_closed",
+			Message: "The contest is closed, its votes are final",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
+// finalizedDenied denies any change to the votes of a contest whose final
+// standings were taken, which would no longer match them.
+func finalizedDenied() *Denied {
+	return &Denied{
+		Code:    "contest_finalized",
+		Message: "The contest's final standings were taken, its votes are final",
+		Status:  http.StatusForbidden,
+	}
+}
+
+// CheckRecast returns why a voter cannot vote again on a video whose vote
+// they last retracted at lastRetraction, or nil. A zero lastRetraction means
+// they never retracted it.
+func (r Rules) CheckRecast(lastRetraction time.Time, now time.Time) *Denied {
+	wait := lastRetraction.Add(r.ChangeCooldown).Sub(now)
+	if r.ChangeCooldown <= 0 || wait <= 0 {
+		return nil
+	}
+
+	return &Denied{
+		Code:       "change_cooldown",
+		Message:    fmt.Sprintf("A retracted vote can be cast again after %s", r.ChangeCooldown),
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: max(wait, time.Second),
+	}
+}
+
+func envBool(key string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return v
+}
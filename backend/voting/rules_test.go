@@ -0,0 +1,85 @@
+package voting
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRules_CheckRetraction(t *testing.T) {
+	rules := Rules{AllowRetraction: true, ChangeCooldown: time.Minute}
+
+	cases := []struct {
+		name      string
+		rules     Rules
+		closed    bool
+		finalized bool
+		code      string
+		status    int
+	}{
+		{"allowed", rules, false, false, "", 0},
+		{"disabled", Rules{}, false, false, "retraction_disabled", http.StatusForbidden},
+		{"contest closed", rules, true, false, "contest_closed", http.StatusForbidden},
+		{"closed but allowed", Rules{AllowRetraction: true, RetractAfterClose: true}, true, false, "", 0},
+		{"finalized", Rules{AllowRetraction: true, RetractAfterClose: true}, true, true, "contest_finalized", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		denied := c.rules.CheckRetraction(c.closed, c.finalized)
+		switch {
+		case c.code == "" && denied != nil:
+			t.Errorf("%s: expected no denial, got %v", c.name, denied)
+		case c.code != "" && (denied == nil || denied.Code != c.code || denied.Status != c.status):
+			t.Errorf("%s: expected %s (%d), got %+v", c.name, c.code, c.status, denied)
+		}
+	}
+}
+
+func TestRules_CheckRecastRetryAfter(t *testing.T) {
+	now := time.Now()
+	rules := Rules{ChangeCooldown: time.Minute}
+
+	denied := rules.CheckRecast(now.Add(-15*time.Second), now)
+	if denied == nil || denied.RetryAfter != 45*time.Second {
+		t.Fatalf("expected retry after 45s, got %+v", denied)
+	}
+
+	if denied := rules.CheckRecast(now.Add(-time.Minute), now); denied != nil {
+		t.Errorf("expected the cooldown to be over, got %v", denied)
+	}
+
+	if denied := rules.CheckRecast(time.Time{}, now); denied != nil {
+		t.Errorf("expected a first vote to be allowed, got %v", denied)
+	}
+}
+
+// A mistaken vote can be undone right after casting it, but not cast again
+// until the cooldown after the retraction ends.
+func TestRules_UndoMistakenVote(t *testing.T) {
+	castAt := time.Now()
+	rules := Rules{AllowRetraction: true, ChangeCooldown: time.Minute}
+
+	retractAt := castAt.Add(time.Second)
+	if denied := rules.CheckRetraction(false, false); denied != nil {
+		t.Fatalf("expected the vote to be retracted right after casting, got %v", denied)
+	}
+
+	denied := rules.CheckRecast(retractAt, retractAt.Add(time.Second))
+	if denied == nil || denied.Code != "change_cooldown" || denied.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected the recast to wait for the cooldown, got %+v", denied)
+	}
+	if denied := rules.CheckRecast(retractAt, retractAt.Add(time.Minute)); denied != nil {
+		t.Errorf("expected the recast once the cooldown ends, got %v", denied)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	t.Setenv("VOTE_RETRACTION_ENABLED", "false")
+	t.Setenv("VOTE_RETRACTION_AFTER_CLOSE", "")
+	t.Setenv("VOTE_CHANGE_COOLDOWN", "30s")
+
+	rules := LoadRules()
+	if rules.AllowRetraction || rules.RetractAfterClose || rules.ChangeCooldown != 30*time.Second {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+}
@@ -21,6 +21,7 @@ const videoUploadSuccessRate = new Rate("video_upload_success_rate");
 const scenarioCounter = new Counter("scenario_count");
 const usersCreated = new Counter("users_created");
 const votesCast = new Counter("votes_cast");
+const uploadsThrottled = new Counter("uploads_throttled");
 
 // Endpoint-specific response time trends
 const authResponseTime = new Trend("auth_response_time");
@@ -281,9 +282,14 @@ function basketballPlayerScenario(token) {
 
     videoUploadResponseTime.add(uploadTime);
 
+    // 503 means the backend applied backpressure, not that the upload failed
+    if (uploadResp.status === 503) {
+      uploadsThrottled.add(1);
+    }
+
     const uploadSuccess = check(uploadResp, {
-      "Video upload successful": (r) => r.status === 200,
-      "Video upload returns task_id": (r) => r.json("task_id") !== undefined,
+      "Video upload accepted": (r) => r.status === 202,
+      "Video upload returns status_url": (r) => r.json("status_url") !== undefined,
       "Video upload returns video id": (r) => r.json("video.id") !== undefined,
     });
 
@@ -364,4 +370,13 @@ export default function () {
   sleep(1);
 }
 
-export function teardown() {}
+// Report the same processing signals the autoscaling policies read, so the
+// load-test results can be compared against them directly.
+export function teardown() {
+  const metricsResp = http.get(`${BASE_URL}/api/metrics/processing`);
+  if (metricsResp.status === 200) {
+    console.log(
+      `Processing metrics: ${JSON.stringify(metricsResp.json("data"))}`
+    );
+  }
+}
@@ -43,13 +43,15 @@ export default function RankingsPage() {
             </thead>
             <tbody>
               {rows
-                .sort((a, b) => b.Votes - a.Votes)
-                .map((r, i) => (
-                  <tr key={r.UserID} className="border-b border-white/10">
-                    <td className="px-3 py-2">{i + 1}</td>
-                    <td className="px-3 py-2">{r.Email}</td>
-                    <td className="px-3 py-2">{r.City ?? "—"}</td>
-                    <td className="px-3 py-2 font-bold">{r.Votes}</td>
+                .map((r) => (
+                  <tr key={r.userId} className="border-b border-white/10">
+                    <td className="px-3 py-2">{r.rank}</td>
+                    <td className="px-3 py-2">
+                      {r.displayName ?? r.handle}
+                      <span className="ml-2 opacity-60">@{r.handle}</span>
+                    </td>
+                    <td className="px-3 py-2">{r.city ?? "—"}</td>
+                    <td className="px-3 py-2 font-bold">{r.votes}</td>
                   </tr>
                 ))}
             </tbody>
@@ -18,6 +18,8 @@ export default function SignupPage() {
     city: "",
     country: "",
     type: "player",
+    handle: "",
+    display_name: "",
   });
   const [loading, setLoading] = useState(false);
 
@@ -58,6 +60,10 @@ export default function SignupPage() {
           onChange={(e) => setForm((f) => ({ ...f, city: e.target.value }))} />
         <FormField label="País" value={form.country}
           onChange={(e) => setForm((f) => ({ ...f, country: e.target.value }))} />
+        <FormField label="Handle público (opcional)" value={form.handle}
+          onChange={(e) => setForm((f) => ({ ...f, handle: e.target.value }))} />
+        <FormField label="Nombre público (opcional)" value={form.display_name}
+          onChange={(e) => setForm((f) => ({ ...f, display_name: e.target.value }))} />
         <label className="grid gap-1">
           <span className="text-sm text-gray-200">Tipo</span>
           <select
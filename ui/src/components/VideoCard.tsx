@@ -13,7 +13,8 @@ export default function VideoCard({
 }) {
   const { token, isAuthed } = useAuth();
   const [submitting, setSubmitting] = useState(false);
-  const src = v.processedUrl || v.originalUrl;
+  const [viewed, setViewed] = useState(false);
+  const src = v.processedUrl;
 
   const vote = async () => {
     if (!isAuthed || !token) return alert("Debes iniciar sesión para votar.");
@@ -36,7 +37,7 @@ export default function VideoCard({
   return (
     <div className="rounded-2xl border border-white/10 bg-white/5 p-4">
       <div className="mb-2 text-sm text-white/60">
-        {v.User?.firstName} {v.User?.lastName} · {v.User?.city ?? ""}
+        {v.User?.displayName ?? v.User?.handle} · @{v.User?.handle} · {v.User?.city ?? ""}
         {v.User?.city ? " · " : ""}
         {v.status}
       </div>
@@ -46,6 +47,13 @@ export default function VideoCard({
           controls
           className="h-full w-full"
           preload="metadata"
+          onPlay={() => {
+            // Solo cuentan las reproducciones de usuarios autenticados, una
+            // por video
+            if (viewed || !token) return;
+            setViewed(true);
+            api.viewVideo(token, v.id).catch(() => {});
+          }}
           onError={(e) => {
             console.error("Video load error:", e);
             console.error("Video URL:", src);
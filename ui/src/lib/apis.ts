@@ -54,6 +54,8 @@ export const api = {
   publicVideos: () => request("/public/videos"),
   voteVideo: (token: string, id: number) =>
     request(`/public/videos/${id}/vote`, { method: "POST", token }),
+  viewVideo: (token: string, id: number) =>
+    request(`/public/videos/${id}/views`, { method: "POST", token }),
   myVideos: (token: string) => request("/videos", { token }),
   deleteVideo: (token: string, id: number) =>
     request(`/videos/${id}`, { method: "DELETE", token }),
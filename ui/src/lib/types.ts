@@ -13,6 +13,8 @@ export type SignupBody = {
   city: string;
   country: string;
   type: "player" | "fan" | string;
+  handle?: string;
+  display_name?: string;
 };
 
 export type LoginBody = {
@@ -20,24 +22,26 @@ export type LoginBody = {
   password: string;
 };
 
+export type PublicPlayer = {
+  id: number;
+  handle: string;
+  displayName: string | null;
+  city: string | null;
+  country: string | null;
+};
+
 export type PublicVideo = {
   id: number;
   processedUrl: string | null;
-  originalUrl: string;
+  thumbnailUrl: string | null;
   title: string;
   status: "uploaded" | "processing" | "processed" | string;
   createdAt: string;
   processedAt: string | null;
+  votes: number;
+  views: number;
   user_id: number;
-  User: {
-    id: number;
-    email: string | null;
-    firstName: string | null;
-    lastName: string | null;
-    city: string | null;
-    country: string | null;
-    type: string | null;
-  };
+  User: PublicPlayer;
 };
 
 export type MyVideo = {
@@ -50,8 +54,13 @@ export type MyVideo = {
 };
 
 export type RankingRow = {
-  UserID: number;
-  Email: string;
-  City: string | null;
-  Votes: number;
+  userId: number;
+  handle: string;
+  displayName: string | null;
+  city: string | null;
+  votes: number;
+  rank: number;
+  videos: number;
+  bestVideoId: number;
+  bestVideoTitle: string | null;
 };